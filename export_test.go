@@ -1,5 +0,0 @@
-package main
-
-var ExportPathMatcher = pathMatcher
-var ExportQueryMatcher = queryMatcher
-var ExportLoadConfig = loadConfig
@@ -3,3 +3,5 @@ module github.com/dev-shimada/api-stubs
 go 1.24.0
 
 require github.com/google/go-cmp v0.7.0
+
+require google.golang.org/protobuf v1.36.12
@@ -2,165 +2,121 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log/slog"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"regexp"
-	"slices"
 	"strings"
 	"syscall"
-	"text/template"
 	"time"
-)
-
-// define the structure of the JSON configuration file
-type Matcher struct {
-	EqualTo        any `json:"equalTo"`
-	Matches        any `json:"matches"`
-	DoesNotMatch   any `json:"doesNotMatch"`
-	Contains       any `json:"contains"`
-	DoesNotContain any `json:"doesNotContain"`
-}
-type Request struct {
-	URL             string `json:"url"`             // パスパラメータ、クエリパラメータを含む完全一致
-	URLPattern      string `json:"urlPattern"`      // パスパラメータ、クエリパラメータを含む正規表現での完全一致
-	URLPath         string `json:"urlPath"`         // パスパラメータを含む完全一致
-	URLPathPattern  string `json:"urlPathPattern"`  // パスパラメータを含む正規表現での完全一致
-	URLPathTemplate string `json:"urlPathTemplate"` // パスパラメータを含むテンプレートでの完全一致
 
-	Method          string             `json:"method"`
-	QueryParameters map[string]Matcher `json:"queryParameters"`
-	PathParameters  map[string]Matcher `json:"pathParameters"`
-	Body            Matcher            `json:"body"`
-}
-type Response struct {
-	Status        int               `json:"status"`
-	BodyFileName  string            `json:"bodyFileName"` // bodyFileNameが指定されている場合は、bodyは無視される
-	Body          string            `json:"body"`         // bodyFileNameが指定されていない場合は、bodyを使用する
-	Headers       map[string]string `json:"headers"`
-	Transformaers []string          `json:"transformers"`
-}
-type Endpoint struct {
-	Request  Request  `json:"request"`
-	Response Response `json:"response"`
-}
+	"github.com/dev-shimada/api-stubs/stubs"
+)
 
 func main() {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		endpoints, err := loadConfig("configs")
-		if err != nil {
-			slog.Error(fmt.Sprintf("Failed to load configuration: %v", err))
+	if len(os.Args) > 1 && os.Args[1] == "wsdl" {
+		if err := wsdlCommand(os.Args[2:]); err != nil {
+			slog.Error(fmt.Sprintf("Failed to import WSDL: %v", err))
+			os.Exit(1)
 		}
-		for _, endpoint := range endpoints {
-			var responseBody string
-			switch {
-			case endpoint.Response.BodyFileName != "":
-				file, err := os.Open(endpoint.Response.BodyFileName)
-				if err != nil {
-					http.Error(w, "Failed to open body file", http.StatusInternalServerError)
-					return
-				}
-				defer file.Close()
-			case endpoint.Response.Body != "":
-				responseBody = endpoint.Response.Body
-			default:
-				slog.Error("Response body is empty")
-				http.Error(w, "Response body is empty", http.StatusInternalServerError)
-				return
-			}
-
-			isMatchPath, pathMap := pathMatcher(endpoint, r.URL.RawPath, r.URL.Path)
-			isMatchQuery := queryMatcher(endpoint, r.URL.Query())
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				slog.Error(fmt.Sprintf("Failed to read request body: %s", err))
-				http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-				return
-			}
-			isMatchBody := bodyMatcher(endpoint, string(body))
-			if r.Method == endpoint.Request.Method && isMatchPath && isMatchQuery && isMatchBody {
-				w.WriteHeader(endpoint.Response.Status)
-
-				type gotParams struct {
-					Path  map[string]string
-					Query map[string]string
-				}
-				q := make(map[string]string)
-				for k, v := range r.URL.Query() {
-					q[k] = v[0]
-				}
-				gp := gotParams{
-					Query: q,
-					Path:  pathMap,
-				}
-
-				// bodyFileNameが指定されている場合は、bodyは無視される
-				if endpoint.Response.BodyFileName != "" {
-					file, err := os.Open(endpoint.Response.BodyFileName)
-					if err != nil {
-						slog.Error(fmt.Sprintf("Failed to open body file: %s", err))
-						http.Error(w, "Failed to open body file", http.StatusInternalServerError)
-						return
-					}
-					defer file.Close()
-					body, err := io.ReadAll(file)
-					if err != nil {
-						slog.Error(fmt.Sprintf("Failed to read body file: %s", err))
-						http.Error(w, "Failed to read body file", http.StatusInternalServerError)
-						return
-					}
-					responseBody = string(body)
-					tpl, err := template.New("response").Parse(responseBody)
-					if err != nil {
-						slog.Error(fmt.Sprintf("Failed to parse response template: %s", err))
-						http.Error(w, "Failed to parse response template", http.StatusInternalServerError)
-						return
-					}
-					if err := tpl.Execute(w, gp); err != nil {
-						slog.Error(fmt.Sprintf("Failed to execute response template: %s", err))
-						http.Error(w, "Failed to execute response template", http.StatusInternalServerError)
-						return
-					}
-					return
-				}
-
-				// bodyFileNameが指定されていない場合は、bodyを使用する
-				tpl, err := template.New("response").Parse(responseBody)
-				if err != nil {
-					slog.Error(fmt.Sprintf("Failed to parse response template: %s", err))
-					http.Error(w, "Failed to parse response template", http.StatusInternalServerError)
-					return
-				}
-				if err := tpl.Execute(w, gp); err != nil {
-					slog.Error(fmt.Sprintf("Failed to execute response template: %s", err))
-					http.Error(w, "Failed to execute response template", http.StatusInternalServerError)
-					return
-				}
-				return
-			}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "record" {
+		if err := recordCommand(os.Args[2:]); err != nil {
+			slog.Error(fmt.Sprintf("Failed to record: %v", err))
+			os.Exit(1)
 		}
-		http.NotFound(w, r)
+		return
+	}
+
+	opts := stubs.Options{Dir: "configs"}
+	descriptorSets := flag.String("descriptor-set", "", "comma separated FileDescriptorSet files for gRPC stubs")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file")
+	tlsKey := flag.String("tls-key", "", "TLS key file")
+	flag.DurationVar(&opts.Delay, "delay", 0, "delay added to every response")
+	flag.StringVar(&opts.ProxyURL, "proxy-url", "", "upstream that requests matching no stub are forwarded to")
+	flag.Func("proxy-add-header", "`Name: value` header added to proxied requests (repeatable)", func(s string) error {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			return errors.New("header must be Name: value")
+		}
+		if opts.Proxy.AddRequestHeaders == nil {
+			opts.Proxy.AddRequestHeaders = make(map[string]string)
+		}
+		opts.Proxy.AddRequestHeaders[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		return nil
+	})
+	flag.Func("proxy-remove-header", "header removed from proxied requests (repeatable)", func(s string) error {
+		opts.Proxy.RemoveRequestHeaders = append(opts.Proxy.RemoveRequestHeaders, s)
+		return nil
 	})
+	proxyTimeout := flag.Duration("proxy-timeout", 30*time.Second, "timeout of proxied requests")
+	flag.BoolVar(&opts.Proxy.InsecureSkipVerify, "proxy-insecure", false, "skip verification of the upstream's TLS certificate")
+	flag.StringVar(&opts.Proxy.CAFile, "proxy-ca", "", "CA certificate (PEM) to verify the upstream with")
+	flag.Uint64Var(&opts.Seed, "seed", 0, "seed for randomResponses (0 picks a random seed)")
+	flag.StringVar(&opts.JournalFile, "journal-file", "requests.jsonl", "file the request journal is appended to (empty disables it)")
+	flag.Int64Var(&opts.JournalMaxSize, "journal-max-size", 10<<20, "size in bytes at which the journal file is rotated (0 disables rotation)")
+	flag.IntVar(&opts.JournalMaxFiles, "journal-max-files", 5, "number of rotated journal files to keep")
+	flag.IntVar(&opts.JournalSize, "journal-size", 1000, "number of requests kept in memory for the requests API")
+	flag.IntVar(&opts.JournalBodyLimit, "journal-body-limit", 8192, "bytes of each request body kept in the journal, negative for no limit")
+	adminAddr := flag.String("admin-addr", "", "serve the /__admin API on this address instead of the main port")
+	flag.StringVar(&opts.AdminToken, "admin-token", "", "bearer token required by the /__admin API")
+	flag.BoolVar(&opts.AdminPersist, "admin-persist", false, "write stubs changed over the /__admin API back to the config files")
+	flag.Parse()
+	opts.Proxy.TimeoutMilliseconds = int(proxyTimeout.Milliseconds())
+	if *descriptorSets != "" {
+		opts.DescriptorSets = strings.Split(*descriptorSets, ",")
+	}
+	opts.SeparateAdmin = *adminAddr != ""
+
+	server, err := stubs.NewServer(opts)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to start server: %v", err))
+		os.Exit(1)
+	}
+	defer server.Close()
 
 	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	// defer stop()
 
+	// gRPC clients speak HTTP/2 without TLS (h2c) unless a certificate is configured
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	// requests are canceled on shutdown so that delayed responses don't hold it up
+	baseCtx := ctx
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:        ":8080",
+		Handler:     server,
+		Protocols:   protocols,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	var adminSrv *http.Server
+	if *adminAddr != "" {
+		adminSrv = &http.Server{Addr: *adminAddr, Handler: server.AdminHandler()}
+		slog.Info(fmt.Sprintf("Admin API is running at %s", *adminAddr))
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error(fmt.Sprintf("Admin ListenAndServe: %v", err))
+			}
+		}()
 	}
 
 	slog.Info("Server is running at :8080 Press CTRL-C to exit.")
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		var err error
+		if *tlsCert != "" {
+			err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			if err == http.ErrServerClosed {
 				slog.Info("Server closed.")
 			} else {
@@ -176,183 +132,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Info(fmt.Sprintf("HTTP server Shutdown: %v", err))
 	}
-}
-
-func pathMatcher(endpoint Endpoint, gotRawPath, gotPath string) (bool, map[string]string) {
-	// trim trailing slashes
-	gotPath = strings.TrimRight(gotPath, "/")
-	gotRawPath = strings.TrimRight(gotRawPath, "/")
-
-	var url string
-	switch {
-	case endpoint.Request.URL != "":
-		url = strings.TrimRight(endpoint.Request.URL, "/")
-		if gotRawPath != url {
-			return false, nil
-		}
-		return true, nil
-	case endpoint.Request.URLPattern != "":
-		url = strings.TrimRight(endpoint.Request.URLPattern, "/")
-		if !regexp.MustCompile(url).MatchString(gotRawPath) {
-			return false, nil
-		}
-		return true, nil
-	case endpoint.Request.URLPath != "":
-		url = strings.TrimRight(endpoint.Request.URLPath, "/")
-		if gotPath != url {
-			return false, nil
-		}
-		return true, nil
-	case endpoint.Request.URLPathPattern != "":
-		url = strings.TrimRight(endpoint.Request.URLPathPattern, "/")
-		if !regexp.MustCompile(url).MatchString(gotPath) {
-			return false, nil
-		}
-		return true, nil
-	case endpoint.Request.URLPathTemplate != "":
-		url = strings.TrimRight(endpoint.Request.URLPathTemplate, "/")
-	default:
-		return false, nil
-	}
-
-	// check if the path parameters match
-	requredPathUnits := strings.Split(url, "/")
-	gotPathUnits := strings.Split(gotPath, "/")
-	if len(requredPathUnits) != len(gotPathUnits) {
-		return false, nil
-	}
-
-	// placeholder->position
-	posMap := make(map[string]int)
-	for k := range endpoint.Request.PathParameters {
-		placeHolder := fmt.Sprintf("{%s}", k)
-		if i := slices.Index(requredPathUnits, placeHolder); i == -1 {
-			slog.Error(fmt.Sprintf("Path parameter %s not found in path %s", k, gotPath))
-			return false, nil
-		} else {
-			posMap[k] = i
-		}
-	}
-
-	for k, v := range endpoint.Request.PathParameters {
-		if v.EqualTo != nil {
-			if gotPathUnits[posMap[k]] != fmt.Sprint(v.EqualTo) {
-				return false, nil
-			}
-		}
-		if v.Matches != nil {
-			if !regexp.MustCompile(v.Matches.(string)).MatchString(gotPathUnits[posMap[k]]) {
-				return false, nil
-			}
-		}
-		if v.DoesNotMatch != nil {
-			if regexp.MustCompile(v.DoesNotMatch.(string)).MatchString(gotPathUnits[posMap[k]]) {
-				return false, nil
-			}
-		}
-		if v.Contains != nil {
-			if !strings.Contains(gotPathUnits[posMap[k]], v.Contains.(string)) {
-				return false, nil
-			}
-		}
-		if v.DoesNotContain != nil {
-			if strings.Contains(gotPathUnits[posMap[k]], v.DoesNotContain.(string)) {
-				return false, nil
-			}
-		}
-	}
-	ret := make(map[string]string)
-	for k, v := range posMap {
-		ret[k] = gotPathUnits[v]
-	}
-	return true, ret
-}
-
-func queryMatcher(endpoint Endpoint, gotQuery url.Values) bool {
-	for k, v := range endpoint.Request.QueryParameters {
-		if v.EqualTo != nil {
-			if gotQuery.Get(k) != fmt.Sprint(v.EqualTo) {
-				return false
-			}
-		}
-		if v.Matches != nil {
-			if !regexp.MustCompile(v.Matches.(string)).MatchString(gotQuery.Get(k)) {
-				return false
-			}
-		}
-		if v.DoesNotMatch != nil {
-			if regexp.MustCompile(v.DoesNotMatch.(string)).MatchString(gotQuery.Get(k)) {
-				return false
-			}
-		}
-		if v.Contains != nil {
-			if !strings.Contains(gotQuery.Get(k), v.Contains.(string)) {
-				return false
-			}
-		}
-		if v.DoesNotContain != nil {
-			if strings.Contains(gotQuery.Get(k), v.DoesNotContain.(string)) {
-				return false
-			}
-		}
-	}
-	return true
-}
-
-func bodyMatcher(endpoint Endpoint, body string) bool {
-	if endpoint.Request.Body.EqualTo != nil {
-		if body != fmt.Sprint(endpoint.Request.Body.EqualTo) {
-			return false
-		}
-	}
-	if endpoint.Request.Body.Matches != nil {
-		if !regexp.MustCompile(endpoint.Request.Body.Matches.(string)).MatchString(body) {
-			return false
-		}
-	}
-	if endpoint.Request.Body.DoesNotMatch != nil {
-		if regexp.MustCompile(endpoint.Request.Body.DoesNotMatch.(string)).MatchString(body) {
-			return false
-		}
-	}
-	if endpoint.Request.Body.Contains != nil {
-		if !strings.Contains(body, endpoint.Request.Body.Contains.(string)) {
-			return false
-		}
-	}
-	if endpoint.Request.Body.DoesNotContain != nil {
-		if strings.Contains(body, endpoint.Request.Body.DoesNotContain.(string)) {
-			return false
-		}
-	}
-	return true
-}
-
-func loadConfig(dir string) ([]Endpoint, error) {
-	var endpoints []Endpoint
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() || filepath.Ext(path) != ".json" {
-			return nil
-		}
-		file, err := os.Open(path)
-		if err != nil {
-			return err
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			slog.Info(fmt.Sprintf("Admin server Shutdown: %v", err))
 		}
-		defer file.Close()
-		byteValue, _ := io.ReadAll(file)
-		err = json.Unmarshal(byteValue, &endpoints)
-		if err != nil {
-			return err
-		}
-		endpoints = append(endpoints, endpoints...)
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-
-	return endpoints, nil
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dev-shimada/api-stubs/stubs"
+)
+
+func recordCommand(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	target := fs.String("target", "", "upstream base URL to record (required)")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	dir := fs.String("dir", "configs/recorded", "directory to write stubs to")
+	filesDir := fs.String("files-dir", "files/recorded", "directory to write large and binary bodies to")
+	match := fs.String("match", "query", "comma separated request parts matched in addition to method and path (query, body)")
+	bodyLimit := fs.Int("body-limit", 4096, "bodies larger than this many bytes are written to files")
+	dedupe := fs.Bool("dedupe", true, "record only the first response to repeated requests; otherwise record them as a response sequence")
+	insecure := fs.Bool("insecure", false, "skip verification of the upstream's TLS certificate")
+	ca := fs.String("ca", "", "PEM file with the CA to verify the upstream's certificate")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: api-stubs record -target https://api.example.com [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *target == "" {
+		fs.Usage()
+		return errors.New("-target is required")
+	}
+	var parts []string
+	for _, part := range strings.Split(*match, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	rc, err := stubs.NewRecorder(*target, stubs.RecordOptions{
+		Dir:       *dir,
+		FilesDir:  *filesDir,
+		Match:     parts,
+		BodyLimit: *bodyLimit,
+		Dedupe:    *dedupe,
+		Proxy:     stubs.ProxyOptions{InsecureSkipVerify: *insecure, CAFile: *ca},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: *addr, Handler: rc}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	slog.Info(fmt.Sprintf("Recording %s at %s Press CTRL-C to exit.", *target, *addr))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,381 @@
+package stubs
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+var (
+	errStubExists   = errors.New("stub already exists")
+	errStubNotFound = errors.New("stub not found")
+)
+
+// stubStore layers stubs changed over the admin API on top of the stubs in
+// the config directory and those given in code. With persist, changes are
+// also written to the files.
+type stubStore struct {
+	mu       sync.Mutex
+	dir      string     // 空の場合はファイルから読み込まない
+	base     []Endpoint // ファイルのスタブの後に照合するスタブ
+	persist  bool
+	created  []Endpoint          // API で作成したスタブ。ファイルのスタブより優先する
+	replaced map[string]Endpoint // API で更新したファイルのスタブ
+	deleted  map[string]bool     // API で削除したファイルのスタブ
+}
+
+func newStubStore(dir string, base []Endpoint, persist bool) *stubStore {
+	base = slices.Clone(base)
+	for i := range base {
+		if base[i].ID == "" {
+			base[i].ID = fmt.Sprintf("endpoints#%d", i)
+		}
+	}
+	return &stubStore{dir: dir, base: base, persist: persist, replaced: map[string]Endpoint{}, deleted: map[string]bool{}}
+}
+
+// endpoints returns the stubs in the order they are matched.
+func (s *stubStore) endpoints() ([]Endpoint, error) {
+	var files []Endpoint
+	var err error
+	if s.dir != "" {
+		files, err = loadConfig(s.dir)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoints := slices.Clone(s.created)
+	for _, e := range slices.Concat(files, s.base) {
+		if s.deleted[e.ID] || slices.ContainsFunc(s.created, func(c Endpoint) bool { return c.ID == e.ID }) {
+			continue
+		}
+		if r, ok := s.replaced[e.ID]; ok {
+			e = r
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, err
+}
+
+func (s *stubStore) get(id string) (Endpoint, error) {
+	endpoints, err := s.endpoints()
+	if err != nil {
+		return Endpoint{}, err
+	}
+	i := slices.IndexFunc(endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		return Endpoint{}, errStubNotFound
+	}
+	return endpoints[i], nil
+}
+
+// create adds a stub in front of the others, with a generated id when it has none.
+func (s *stubStore) create(e Endpoint) (Endpoint, error) {
+	if e.ID == "" {
+		e.ID = newUUID()
+	}
+	if _, err := s.get(e.ID); !errors.Is(err, errStubNotFound) {
+		if err == nil {
+			err = errStubExists
+		}
+		return Endpoint{}, err
+	}
+	if err := s.write(e.ID, &e); err != nil {
+		return Endpoint{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append([]Endpoint{e}, s.created...)
+	return e, nil
+}
+
+func (s *stubStore) update(id string, e Endpoint) (Endpoint, error) {
+	if _, err := s.get(id); err != nil {
+		return Endpoint{}, err
+	}
+	e.ID = id
+	if err := s.write(id, &e); err != nil {
+		return Endpoint{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.IndexFunc(s.created, func(c Endpoint) bool { return c.ID == id }); i >= 0 {
+		s.created[i] = e
+	} else {
+		s.replaced[id] = e
+	}
+	return e, nil
+}
+
+func (s *stubStore) remove(id string) error {
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	if err := s.write(id, nil); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = slices.DeleteFunc(s.created, func(c Endpoint) bool { return c.ID == id })
+	delete(s.replaced, id)
+	s.deleted[id] = true
+	return nil
+}
+
+// reset drops the changes made over the API that were not persisted.
+func (s *stubStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = nil
+	clear(s.replaced)
+	clear(s.deleted)
+}
+
+// write persists a change to the stub: the file holding it is rewritten, or
+// removed once empty, and new stubs are written to their own file under
+// admin/. Stubs in a rewritten file get their ids pinned so they keep them.
+func (s *stubStore) write(id string, e *Endpoint) error {
+	if !s.persist {
+		return nil
+	}
+	path, endpoints, err := s.stubFile(id)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		if e == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Join(s.dir, "admin"), 0o755); err != nil {
+			return err
+		}
+		path = filepath.Join(s.dir, "admin", url.PathEscape(id)+".json")
+		endpoints = []Endpoint{*e}
+	} else {
+		i := slices.IndexFunc(endpoints, func(f Endpoint) bool { return f.ID == id })
+		if e != nil {
+			endpoints[i] = *e
+		} else {
+			endpoints = slices.Delete(endpoints, i, i+1)
+		}
+	}
+	if len(endpoints) == 0 {
+		return os.Remove(path)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(endpoints); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// stubFile finds the config file with the stub, returning its stubs with ids.
+func (s *stubStore) stubFile(id string) (string, []Endpoint, error) {
+	var found string
+	var endpoints []Endpoint
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || found != "" {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		fileEndpoints, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(fileEndpoints, func(e Endpoint) bool { return e.ID == id }) {
+			found, endpoints = path, fileEndpoints
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return found, endpoints, err
+}
+
+func (s *stubStore) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /__admin/stubs", s.handleList)
+	mux.HandleFunc("POST /__admin/stubs", s.handleCreate)
+	mux.HandleFunc("GET /__admin/stubs/{id...}", s.handleGet)
+	mux.HandleFunc("PUT /__admin/stubs/{id...}", s.handleUpdate)
+	mux.HandleFunc("DELETE /__admin/stubs/{id...}", s.handleDelete)
+	mux.HandleFunc("POST /__admin/stubs/reset", s.handleReset)
+	mux.HandleFunc("GET /__admin/stubs/export", s.handleExport)
+	mux.HandleFunc("POST /__admin/stubs/import", s.handleImport)
+}
+
+func (s *stubStore) handleList(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := s.endpoints()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load configuration: %v", err))
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{"stubs": endpoints, "total": len(endpoints)})
+}
+
+func (s *stubStore) handleGet(w http.ResponseWriter, r *http.Request) {
+	e, err := s.get(r.PathValue("id"))
+	if err != nil {
+		writeStubError(w, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, e)
+}
+
+func (s *stubStore) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var e Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid stub: %s", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateEndpoint(e); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid stub: %s", err), http.StatusBadRequest)
+		return
+	}
+	e, err := s.create(e)
+	if err != nil {
+		writeStubError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/__admin/stubs/"+url.PathEscape(e.ID))
+	writeAdminJSON(w, http.StatusCreated, e)
+}
+
+func (s *stubStore) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var e Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid stub: %s", err), http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if e.ID != "" && e.ID != id {
+		http.Error(w, "The id of a stub cannot be changed", http.StatusConflict)
+		return
+	}
+	if err := validateEndpoint(e); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid stub: %s", err), http.StatusBadRequest)
+		return
+	}
+	e, err := s.update(id, e)
+	if err != nil {
+		writeStubError(w, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, e)
+}
+
+func (s *stubStore) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := s.remove(r.PathValue("id")); err != nil {
+		writeStubError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *stubStore) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleExport answers GET /__admin/stubs/export with the stubs in the format
+// of a config file.
+func (s *stubStore) handleExport(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := s.endpoints()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load configuration: %v", err))
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+	if endpoints == nil {
+		endpoints = []Endpoint{}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="stubs.json"`)
+	writeAdminJSON(w, http.StatusOK, endpoints)
+}
+
+// handleImport answers POST /__admin/stubs/import with a config file. Stubs
+// with the id of an existing stub replace it, the others are created.
+func (s *stubStore) handleImport(w http.ResponseWriter, r *http.Request) {
+	var endpoints []Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid stubs: %s", err), http.StatusBadRequest)
+		return
+	}
+	// nothing is imported unless every stub is valid
+	for i, e := range endpoints {
+		if err := validateEndpoint(e); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid stub %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+	created, updated := 0, 0
+	// created stubs go in front, so import in reverse to keep the order
+	for _, e := range slices.Backward(endpoints) {
+		_, err := s.get(e.ID)
+		switch {
+		case e.ID != "" && err == nil:
+			_, err = s.update(e.ID, e)
+			updated++
+		case e.ID == "" || errors.Is(err, errStubNotFound):
+			_, err = s.create(e)
+			created++
+		}
+		if err != nil {
+			writeStubError(w, err)
+			return
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]int{"created": created, "updated": updated})
+}
+
+func writeStubError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errStubNotFound):
+		http.Error(w, "Stub not found", http.StatusNotFound)
+	case errors.Is(err, errStubExists):
+		http.Error(w, "Stub already exists", http.StatusConflict)
+	default:
+		slog.Error(fmt.Sprintf("Failed to update stubs: %v", err))
+		http.Error(w, "Failed to update stubs", http.StatusInternalServerError)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write response: %s", err))
+	}
+}
+
+// requireToken rejects requests without the bearer token. An empty token
+// lets every request through.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api-stubs admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,211 @@
+package stubs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const adminTestStubs = `[
+  {"request": {"method": "GET", "urlPath": "/a"}, "response": {"body": "a"}},
+  {"request": {"method": "GET", "urlPath": "/b"}, "response": {"body": "b"}}
+]`
+
+func adminTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stubs.json"), []byte(adminTestStubs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func adminDo(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+// stubBodies lists the id and body of the stubs in match order.
+func stubBodies(endpoints []Endpoint, err error) []string {
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var got []string
+	for _, e := range endpoints {
+		got = append(got, filepath.Base(e.ID)+"="+e.Response.Body)
+	}
+	return got
+}
+
+func Test_stubStore(t *testing.T) {
+	silenceLogs(t)
+	for _, persist := range []bool{false, true} {
+		t.Run(map[bool]string{false: "memory", true: "persist"}[persist], func(t *testing.T) {
+			dir := adminTestDir(t)
+			file := filepath.ToSlash(filepath.Join(dir, "stubs.json")) + "#"
+			store := newStubStore(dir, nil, persist)
+			mux := muxOf(store.register)
+
+			rec := adminDo(t, mux, http.MethodPost, "/__admin/stubs", `{"id": "new", "request": {"method": "GET", "urlPath": "/a"}, "response": {"body": "override"}}`)
+			if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/__admin/stubs/new" {
+				t.Fatalf("create = %d %s", rec.Code, rec.Header())
+			}
+			if rec := adminDo(t, mux, http.MethodPost, "/__admin/stubs", `{"id": "new"}`); rec.Code != http.StatusConflict {
+				t.Errorf("create of an existing id = %d, want 409", rec.Code)
+			}
+			escaped := "/__admin/stubs/" + url.PathEscape(file)
+			if rec := adminDo(t, mux, http.MethodPut, escaped+"1", `{"request": {"method": "GET", "urlPath": "/b"}, "response": {"body": "b2"}}`); rec.Code != http.StatusOK {
+				t.Errorf("update = %d %s", rec.Code, rec.Body)
+			}
+			if rec := adminDo(t, mux, http.MethodDelete, escaped+"0", ""); rec.Code != http.StatusNoContent {
+				t.Errorf("delete = %d %s", rec.Code, rec.Body)
+			}
+			if rec := adminDo(t, mux, http.MethodDelete, escaped+"0", ""); rec.Code != http.StatusNotFound {
+				t.Errorf("second delete = %d, want 404", rec.Code)
+			}
+			if rec := adminDo(t, mux, http.MethodPut, "/__admin/stubs/new", `{"id": "other"}`); rec.Code != http.StatusConflict {
+				t.Errorf("update changing the id = %d, want 409", rec.Code)
+			}
+
+			want := []string{"new=override", "stubs.json#1=b2"}
+			if diff := cmp.Diff(want, stubBodies(store.endpoints())); diff != "" {
+				t.Errorf("stubs mismatch (-want +got):\n%s", diff)
+			}
+			rec = adminDo(t, mux, http.MethodGet, "/__admin/stubs/new", "")
+			var got Endpoint
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Response.Body != "override" {
+				t.Errorf("get = %d %+v", rec.Code, got)
+			}
+
+			// only persisted changes survive a reset, or a restart
+			adminDo(t, mux, http.MethodPost, "/__admin/stubs/reset", "")
+			if !persist {
+				want = []string{"stubs.json#0=a", "stubs.json#1=b"}
+			}
+			if diff := cmp.Diff(want, stubBodies(store.endpoints())); diff != "" {
+				t.Errorf("stubs after reset mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(want, stubBodies(loadConfig(dir))); persist && diff != "" {
+				t.Errorf("stubs on disk mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_stubStoreImportExport(t *testing.T) {
+	store := newStubStore(adminTestDir(t), nil, false)
+	mux := muxOf(store.register)
+	rec := adminDo(t, mux, http.MethodPost, "/__admin/stubs/import", `[
+		{"id": "x", "response": {"body": "x"}},
+		{"id": "y", "response": {"body": "y"}}
+	]`)
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"created":2,"updated":0}` {
+		t.Fatalf("import = %d %s", rec.Code, body)
+	}
+
+	rec = adminDo(t, mux, http.MethodGet, "/__admin/stubs/export", "")
+	exported := rec.Body.String()
+	rec = adminDo(t, mux, http.MethodPost, "/__admin/stubs/import", strings.Replace(exported, `"body":"b"`, `"body":"b2"`, 1))
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"created":0,"updated":4}` {
+		t.Fatalf("import of the export = %d %s", rec.Code, body)
+	}
+	want := []string{"x=x", "y=y", "stubs.json#0=a", "stubs.json#1=b2"}
+	if diff := cmp.Diff(want, stubBodies(store.endpoints())); diff != "" {
+		t.Errorf("stubs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_stubStoreRejectsInvalidStubs(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "create with a bad regexp",
+			method:   http.MethodPost,
+			target:   "/__admin/stubs",
+			body:     `{"request": {"method": "GET", "urlPath": "/c", "queryParameters": {"id": {"matches": "("}}}, "response": {"body": "c"}}`,
+			wantBody: "Invalid stub: request.queryParameters.id.matches: error parsing regexp: missing closing ): `(`\n",
+		},
+		{
+			name:     "create with an unknown fault",
+			method:   http.MethodPost,
+			target:   "/__admin/stubs",
+			body:     `{"request": {"method": "GET", "urlPath": "/c"}, "response": {"fault": "EXPLODE"}}`,
+			wantBody: "Invalid stub: response.fault: unknown fault \"EXPLODE\"\n",
+		},
+		{
+			name:     "update with an unknown transformer",
+			method:   http.MethodPut,
+			target:   "/__admin/stubs/" + url.PathEscape("stubs.json#0"),
+			body:     `{"request": {"method": "GET", "urlPath": "/a"}, "response": {"body": "a", "transformers": ["nope"]}}`,
+			wantBody: "Invalid stub: response.transformers: unknown transformer \"nope\"\n",
+		},
+		{
+			name:   "import with an invalid sequenceEnd",
+			method: http.MethodPost,
+			target: "/__admin/stubs/import",
+			body: `[
+				{"id": "x", "response": {"body": "x"}},
+				{"id": "y", "responses": [{"body": "y"}], "sequenceEnd": "loop"}
+			]`,
+			wantBody: "Invalid stub 1: sequenceEnd: unknown value \"loop\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "stubs.json"), []byte(adminTestStubs), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			store := newStubStore(dir, nil, false)
+			rec := adminDo(t, muxOf(store.register), tt.method, tt.target, tt.body)
+			if rec.Code != http.StatusBadRequest || rec.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want 400 %q", rec.Code, rec.Body.String(), tt.wantBody)
+			}
+			// nothing was stored
+			want := []string{"stubs.json#0=a", "stubs.json#1=b"}
+			if diff := cmp.Diff(want, stubBodies(store.endpoints())); diff != "" {
+				t.Errorf("stubs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_requireToken(t *testing.T) {
+	h := requireToken("s3cret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{name: "token", authorization: "Bearer s3cret", want: http.StatusOK},
+		{name: "wrong token", authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "missing", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/__admin/stubs", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package stubs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Auth describes the credentials a stub requires. Every configured check must pass.
+type Auth struct {
+	Realm  string     `json:"realm,omitempty"`  // WWW-Authenticate の realm (既定値: api-stubs)
+	Basic  *BasicAuth `json:"basic,omitempty"`  // Basic 認証のユーザー名とパスワード
+	Bearer string     `json:"bearer,omitempty"` // Bearer トークンの完全一致
+	JWT    *JWTAuth   `json:"jwt,omitempty"`    // Bearer トークンを JWT としてデコードしたクレームの検証
+}
+type BasicAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+type JWTAuth struct {
+	Claims   map[string]Matcher `json:"claims,omitempty"`   // クレーム名 (ドット区切りでネスト可) ごとのマッチャー
+	KeyFile  string             `json:"keyFile,omitempty"`  // 署名検証用の PEM 公開鍵、または HMAC の共有鍵ファイル
+	JWKSFile string             `json:"jwksFile,omitempty"` // 署名検証用の JWKS ファイル
+}
+
+const defaultRealm = "api-stubs"
+
+// authMatcher checks the Authorization header against the stub's auth section.
+// When the header is missing it returns the WWW-Authenticate challenge to answer with.
+func authMatcher(endpoint Endpoint, authorization string) (bool, string) {
+	auth := endpoint.Request.Auth
+	if auth == nil {
+		return true, ""
+	}
+	realm := auth.Realm
+	if realm == "" {
+		realm = defaultRealm
+	}
+	if authorization == "" {
+		scheme := "Bearer"
+		if auth.Basic != nil {
+			scheme = "Basic"
+		}
+		return false, fmt.Sprintf("%s realm=%q", scheme, realm)
+	}
+
+	scheme, credentials, _ := strings.Cut(authorization, " ")
+	credentials = strings.TrimSpace(credentials)
+	if auth.Basic != nil {
+		if !strings.EqualFold(scheme, "Basic") {
+			return false, ""
+		}
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return false, ""
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok || !secureEqual(username, auth.Basic.Username) || !secureEqual(password, auth.Basic.Password) {
+			return false, ""
+		}
+	}
+	if auth.Bearer != "" || auth.JWT != nil {
+		if !strings.EqualFold(scheme, "Bearer") {
+			return false, ""
+		}
+	}
+	if auth.Bearer != "" && !secureEqual(credentials, auth.Bearer) {
+		return false, ""
+	}
+	if auth.JWT != nil {
+		claims, err := decodeJWT(credentials, auth.JWT)
+		if err != nil {
+			slog.Info(fmt.Sprintf("JWT rejected: %s", err))
+			return false, ""
+		}
+		if !claimsMatcher(auth.JWT.Claims, claims) {
+			return false, ""
+		}
+	}
+	return true, ""
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// claimsMatcher applies a matcher per claim. Array claims (e.g. aud, roles) match
+// when any of their elements does.
+func claimsMatcher(matchers map[string]Matcher, claims map[string]any) bool {
+	for name, m := range matchers {
+		value, ok := lookupPath(claims, name)
+		if !ok {
+			value = ""
+		}
+		values, isArray := value.([]any)
+		if !isArray {
+			values = []any{value}
+		}
+		matched := false
+		for _, v := range values {
+			if valueMatcher(m, valueString(v)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeJWT returns the claims of a compact JWS token, verifying its signature
+// when a key or JWKS file is configured.
+func decodeJWT(token string, cfg *JWTAuth) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a compact JWS")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	claims := make(map[string]any)
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if cfg.KeyFile == "" && cfg.JWKSFile == "" {
+		return claims, nil
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	var keys []any
+	if cfg.KeyFile != "" {
+		key, err := loadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if cfg.JWKSFile != "" {
+		jwks, err := loadJWKSFile(cfg.JWKSFile, header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	for _, key := range keys {
+		if verifyJWS(header.Alg, key, signingInput, signature) == nil {
+			if err := checkTimeClaims(claims, time.Now()); err != nil {
+				return nil, err
+			}
+			return claims, nil
+		}
+	}
+	return nil, fmt.Errorf("signature verification failed for alg %s", header.Alg)
+}
+
+// checkTimeClaims rejects a token used after its exp or before its nbf.
+func checkTimeClaims(claims map[string]any, now time.Time) error {
+	for _, name := range []string{"exp", "nbf"} {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("invalid %s claim", name)
+		}
+		seconds, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid %s claim: %w", name, err)
+		}
+		at := time.Unix(int64(seconds), 0)
+		if name == "exp" && !now.Before(at) {
+			return fmt.Errorf("token expired at %s", at.Format(time.RFC3339))
+		}
+		if name == "nbf" && now.Before(at) {
+			return fmt.Errorf("token not valid before %s", at.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// loadKeyFile reads a PEM encoded public key or certificate. Anything else is used
+// as a raw HMAC secret.
+func loadKeyFile(name string) (any, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return []byte(strings.TrimRight(string(b), "\r\n")), nil
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKSFile returns the keys of a JWKS file, narrowed to kid when the token names one.
+func loadJWKSFile(name, kid string) ([]any, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+	var keys []any
+	for _, k := range set.Keys {
+		if kid != "" && k.Kid != "" && k.Kid != kid {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			slog.Error(fmt.Sprintf("Skipping JWK %q: %s", k.Kid, err))
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return decode(k.K)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func verifyJWS(alg string, key any, signingInput, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	switch {
+	case strings.HasPrefix(alg, "HS") && hash != 0:
+		secret, ok := key.([]byte)
+		if !ok {
+			return errors.New("HMAC requires a secret key")
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case (strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")) && hash != 0:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RSA algorithm requires an RSA key")
+		}
+		h := hash.New()
+		h.Write(signingInput)
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(pub, hash, h.Sum(nil), signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature)
+	case strings.HasPrefix(alg, "ES") && hash != 0:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ECDSA algorithm requires an EC key")
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		h := hash.New()
+		h.Write(signingInput)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case alg == "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("EdDSA requires an Ed25519 key")
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+}
@@ -0,0 +1,238 @@
+package stubs
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, header, claims map[string]any, sign func(input []byte) []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func Test_authMatcher(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()))
+	if err := os.WriteFile(jwksFile, []byte(jwks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]any{"sub": "user-1", "roles": []string{"reader", "admin"}, "org": map[string]any{"id": 42}}
+	unsigned := signJWT(t, map[string]any{"alg": "none"}, claims, func([]byte) []byte { return nil })
+	hs256 := signJWT(t, map[string]any{"alg": "HS256"}, claims, func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(input)
+		return mac.Sum(nil)
+	})
+	hs256With := func(extra map[string]any) string {
+		c := map[string]any{"sub": "user-1"}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return signJWT(t, map[string]any{"alg": "HS256"}, c, func(input []byte) []byte {
+			mac := hmac.New(sha256.New, []byte("s3cret"))
+			mac.Write(input)
+			return mac.Sum(nil)
+		})
+	}
+	rs256 := signJWT(t, map[string]any{"alg": "RS256", "kid": "k1"}, claims, func(input []byte) []byte {
+		sum := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	})
+
+	basic := func(user, pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+	type args struct {
+		auth          *Auth
+		authorization string
+	}
+	tests := []struct {
+		name          string
+		args          args
+		want          bool
+		wantChallenge string
+	}{
+		{
+			name: "no auth section",
+			args: args{},
+			want: true,
+		},
+		{
+			name: "basic",
+			args: args{
+				auth:          &Auth{Basic: &BasicAuth{Username: "user", Password: "pass"}},
+				authorization: basic("user", "pass"),
+			},
+			want: true,
+		},
+		{
+			name: "basic wrong password",
+			args: args{
+				auth:          &Auth{Basic: &BasicAuth{Username: "user", Password: "pass"}},
+				authorization: basic("user", "nope"),
+			},
+			want: false,
+		},
+		{
+			name: "basic missing",
+			args: args{
+				auth: &Auth{Realm: "partner", Basic: &BasicAuth{Username: "user", Password: "pass"}},
+			},
+			want:          false,
+			wantChallenge: `Basic realm="partner"`,
+		},
+		{
+			name: "bearer",
+			args: args{
+				auth:          &Auth{Bearer: "token"},
+				authorization: "Bearer token",
+			},
+			want: true,
+		},
+		{
+			name: "bearer wrong scheme",
+			args: args{
+				auth:          &Auth{Bearer: "token"},
+				authorization: basic("token", ""),
+			},
+			want: false,
+		},
+		{
+			name: "bearer missing",
+			args: args{
+				auth: &Auth{Bearer: "token"},
+			},
+			want:          false,
+			wantChallenge: `Bearer realm="api-stubs"`,
+		},
+		{
+			name: "jwt claims",
+			args: args{
+				auth: &Auth{JWT: &JWTAuth{Claims: map[string]Matcher{
+					"sub":    {EqualTo: "user-1"},
+					"roles":  {EqualTo: "admin"},
+					"org.id": {EqualTo: 42},
+				}}},
+				authorization: "Bearer " + unsigned,
+			},
+			want: true,
+		},
+		{
+			name: "jwt claims false",
+			args: args{
+				auth: &Auth{JWT: &JWTAuth{Claims: map[string]Matcher{
+					"roles": {EqualTo: "owner"},
+				}}},
+				authorization: "Bearer " + unsigned,
+			},
+			want: false,
+		},
+		{
+			name: "jwt hmac key file",
+			args: args{
+				auth: &Auth{JWT: &JWTAuth{
+					KeyFile: secretFile,
+					Claims:  map[string]Matcher{"sub": {Matches: "^user-"}},
+				}},
+				authorization: "Bearer " + hs256,
+			},
+			want: true,
+		},
+		{
+			name: "jwt unsigned rejected with key file",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{KeyFile: secretFile}},
+				authorization: "Bearer " + unsigned,
+			},
+			want: false,
+		},
+		{
+			name: "jwt within exp and nbf",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{KeyFile: secretFile}},
+				authorization: "Bearer " + hs256With(map[string]any{"exp": time.Now().Add(time.Hour).Unix(), "nbf": time.Now().Add(-time.Hour).Unix()}),
+			},
+			want: true,
+		},
+		{
+			name: "jwt expired",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{KeyFile: secretFile}},
+				authorization: "Bearer " + hs256With(map[string]any{"exp": time.Now().Add(-time.Minute).Unix()}),
+			},
+			want: false,
+		},
+		{
+			name: "jwt not valid yet",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{KeyFile: secretFile}},
+				authorization: "Bearer " + hs256With(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}),
+			},
+			want: false,
+		},
+		{
+			name: "jwt jwks",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{JWKSFile: jwksFile}},
+				authorization: "Bearer " + rs256,
+			},
+			want: true,
+		},
+		{
+			name: "jwt jwks wrong key",
+			args: args{
+				auth:          &Auth{JWT: &JWTAuth{JWKSFile: jwksFile}},
+				authorization: "Bearer " + hs256,
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := Endpoint{Request: Request{Auth: tt.args.auth}}
+			got, gotChallenge := authMatcher(endpoint, tt.args.authorization)
+			if got != tt.want {
+				t.Errorf("authMatcher() = %v, want %v", got, tt.want)
+			}
+			if gotChallenge != tt.wantChallenge {
+				t.Errorf("authMatcher() challenge = %q, want %q", gotChallenge, tt.wantChallenge)
+			}
+		})
+	}
+}
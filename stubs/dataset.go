@@ -0,0 +1,271 @@
+package stubs
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dataset answers list and single-record requests from a JSON or CSV file.
+type Dataset struct {
+	File         string `json:"file"`                   // オブジェクトの JSON 配列、または 1 行目がヘッダーの CSV
+	IDField      string `json:"idField,omitempty"`      // 既定値は id
+	IDParameter  string `json:"idParameter,omitempty"`  // urlPathTemplate のパラメータ名。指定されている場合は 1 件を返す
+	DefaultLimit int    `json:"defaultLimit,omitempty"` // 既定値は 20
+	MaxLimit     int    `json:"maxLimit,omitempty"`     // 既定値は 100
+}
+
+// Query parameters that control the list instead of filtering it.
+var datasetControls = []string{"sort", "page", "limit", "cursor"}
+
+type datasetPage struct {
+	Data       []map[string]any `json:"data"`
+	Total      int              `json:"total"`
+	Page       int              `json:"page"`
+	Limit      int              `json:"limit"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+type cachedDataset struct {
+	modTime time.Time
+	size    int64
+	records []map[string]any
+}
+
+// datasetCache keeps parsed dataset files until they change on disk.
+var datasetCache = struct {
+	mu      sync.Mutex
+	entries map[string]cachedDataset
+}{entries: make(map[string]cachedDataset)}
+
+func loadDataset(name string) ([]map[string]any, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	datasetCache.mu.Lock()
+	defer datasetCache.mu.Unlock()
+	if c, ok := datasetCache.entries[name]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.records, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	var records []map[string]any
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		records, err = parseCSVDataset(b)
+	} else {
+		records, err = parseJSONDataset(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dataset %s: %w", name, err)
+	}
+	datasetCache.entries[name] = cachedDataset{modTime: info.ModTime(), size: info.Size(), records: records}
+	return records, nil
+}
+
+func parseJSONDataset(b []byte) ([]map[string]any, error) {
+	v, err := decodeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("not a JSON array")
+	}
+	records := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		record, ok := item.(map[string]any)
+		if !ok {
+			return nil, errors.New("an element is not an object")
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseCSVDataset(b []byte) ([]map[string]any, error) {
+	rows, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	records := make([]map[string]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]any, len(header))
+		for i, name := range header {
+			record[name] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// queryDataset answers a request from the dataset of the endpoint, returning
+// the body and status.
+func queryDataset(endpoint Endpoint, requestPath string, query url.Values) (string, int, error) {
+	d := endpoint.Response.Dataset
+	records, err := loadDataset(d.File)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if d.IDParameter != "" {
+		id, ok := pathTemplateValue(endpoint.Request.URLPathTemplate, requestPath, d.IDParameter)
+		if !ok {
+			return "", 0, fmt.Errorf("path parameter %s not found in %s", d.IDParameter, endpoint.Request.URLPathTemplate)
+		}
+		idField := d.IDField
+		if idField == "" {
+			idField = "id"
+		}
+		for _, record := range records {
+			if v, ok := lookupPath(record, idField); ok && valueString(v) == id {
+				b, err := json.Marshal(record)
+				return string(b), http.StatusOK, err
+			}
+		}
+		return "Not found\n", http.StatusNotFound, nil
+	}
+
+	var matched []map[string]any
+	for _, record := range records {
+		if datasetFilter(record, query, endpoint.Request.QueryParameters) {
+			matched = append(matched, record)
+		}
+	}
+	if sort := query.Get("sort"); sort != "" {
+		sortDataset(matched, strings.Split(sort, ","))
+	}
+
+	limit := cmp.Or(d.DefaultLimit, 20)
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			return "Invalid limit\n", http.StatusBadRequest, nil
+		}
+	}
+	limit = min(limit, cmp.Or(d.MaxLimit, 100))
+	offset := 0
+	switch {
+	case query.Get("cursor") != "":
+		b, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+		if err == nil {
+			offset, err = strconv.Atoi(string(b))
+		}
+		if err != nil || offset < 0 {
+			return "Invalid cursor\n", http.StatusBadRequest, nil
+		}
+	case query.Get("page") != "":
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			return "Invalid page\n", http.StatusBadRequest, nil
+		}
+		// pages past the end are empty; checked first so the offset can't overflow
+		if page-1 > len(matched)/limit {
+			b, err := json.Marshal(datasetPage{Data: []map[string]any{}, Total: len(matched), Page: page, Limit: limit})
+			return string(b), http.StatusOK, err
+		}
+		offset = (page - 1) * limit
+	}
+	offset = min(offset, len(matched))
+
+	page := datasetPage{Data: []map[string]any{}, Total: len(matched), Page: offset/limit + 1, Limit: limit}
+	if offset < len(matched) {
+		end := min(offset+limit, len(matched))
+		page.Data = matched[offset:end]
+		if end < len(matched) {
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+		}
+	}
+	b, err := json.Marshal(page)
+	return string(b), http.StatusOK, err
+}
+
+// datasetFilter reports whether the record has one of the requested values for
+// every query parameter. Control parameters and those matched by the stub
+// itself don't filter.
+func datasetFilter(record map[string]any, query url.Values, matched map[string]Matcher) bool {
+	for field, values := range query {
+		if slices.Contains(datasetControls, field) {
+			continue
+		}
+		if _, ok := matched[field]; ok {
+			continue
+		}
+		v, ok := lookupPath(record, field)
+		if !ok || !slices.Contains(values, valueString(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortDataset sorts by the given fields; a leading - sorts descending. Values
+// that are both numbers compare numerically.
+func sortDataset(records []map[string]any, fields []string) {
+	slices.SortStableFunc(records, func(a, b map[string]any) int {
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			va, _ := lookupPath(a, field)
+			vb, _ := lookupPath(b, field)
+			c := compareValues(va, vb)
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+func compareValues(a, b any) int {
+	sa, sb := valueString(a), valueString(b)
+	if a == nil {
+		sa = ""
+	}
+	if b == nil {
+		sb = ""
+	}
+	fa, errA := strconv.ParseFloat(sa, 64)
+	fb, errB := strconv.ParseFloat(sb, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(sa, sb)
+}
+
+// pathTemplateValue returns the path segment in the place of {name} in the template.
+func pathTemplateValue(template, requestPath, name string) (string, bool) {
+	units := strings.Split(strings.TrimRight(template, "/"), "/")
+	i := slices.Index(units, "{"+name+"}")
+	got := strings.Split(strings.TrimRight(requestPath, "/"), "/")
+	if i < 0 || i >= len(got) {
+		return "", false
+	}
+	return got[i], true
+}
@@ -0,0 +1,116 @@
+package stubs
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_queryDataset(t *testing.T) {
+	list := Endpoint{
+		Request:  Request{URLPath: "/products", QueryParameters: map[string]Matcher{"apiKey": {EqualTo: "secret"}}},
+		Response: Response{Dataset: &Dataset{File: "testdata/products.csv", DefaultLimit: 2, MaxLimit: 3}},
+	}
+	one := Endpoint{
+		Request:  Request{URLPathTemplate: "/users/{userId}"},
+		Response: Response{Dataset: &Dataset{File: "testdata/users.json", IDParameter: "userId"}},
+	}
+	type page struct {
+		Names      []string
+		Total      int
+		Page       int
+		Limit      int
+		NextCursor bool
+	}
+	tests := []struct {
+		name       string
+		endpoint   Endpoint
+		path       string
+		query      string
+		wantStatus int
+		wantPage   *page
+		wantBody   string
+	}{
+		{name: "first page", endpoint: list, path: "/products", wantStatus: 200, wantPage: &page{Names: []string{"Apple", "Banana"}, Total: 5, Page: 1, Limit: 2, NextCursor: true}},
+		{name: "filter", endpoint: list, path: "/products", query: "status=active&apiKey=secret", wantStatus: 200, wantPage: &page{Names: []string{"Apple", "Cherry"}, Total: 3, Page: 1, Limit: 2, NextCursor: true}},
+		{name: "filter any of", endpoint: list, path: "/products", query: "status=inactive&status=discontinued", wantStatus: 200, wantPage: &page{Names: []string{"Banana", "Elderberry"}, Total: 2, Page: 1, Limit: 2}},
+		{name: "numeric sort descending", endpoint: list, path: "/products", query: "sort=-price&limit=3", wantStatus: 200, wantPage: &page{Names: []string{"Durian", "Cherry", "Apple"}, Total: 5, Page: 1, Limit: 3, NextCursor: true}},
+		{name: "multi-field sort", endpoint: list, path: "/products", query: "sort=status,-name&limit=3", wantStatus: 200, wantPage: &page{Names: []string{"Durian", "Cherry", "Apple"}, Total: 5, Page: 1, Limit: 3, NextCursor: true}},
+		{name: "limit capped", endpoint: list, path: "/products", query: "limit=50", wantStatus: 200, wantPage: &page{Names: []string{"Apple", "Banana", "Cherry"}, Total: 5, Page: 1, Limit: 3, NextCursor: true}},
+		{name: "last page", endpoint: list, path: "/products", query: "page=3", wantStatus: 200, wantPage: &page{Names: []string{"Elderberry"}, Total: 5, Page: 3, Limit: 2}},
+		{name: "past the end", endpoint: list, path: "/products", query: "page=9", wantStatus: 200, wantPage: &page{Names: []string{}, Total: 5, Page: 9, Limit: 2}},
+		{name: "page overflowing the offset", endpoint: list, path: "/products", query: "page=9223372036854775807&limit=2", wantStatus: 200, wantPage: &page{Names: []string{}, Total: 5, Page: 9223372036854775807, Limit: 2}},
+		{name: "bad page", endpoint: list, path: "/products", query: "page=0", wantStatus: 400},
+		{name: "bad cursor", endpoint: list, path: "/products", query: "cursor=!!", wantStatus: 400},
+		{name: "single record", endpoint: one, path: "/users/2", wantStatus: 200, wantBody: `{"id":2,"name":"Bob","role":"user"}`},
+		{name: "missing record", endpoint: one, path: "/users/9", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			body, status, err := queryDataset(tt.endpoint, tt.path, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.wantStatus, body)
+			}
+			if tt.wantBody != "" {
+				if diff := cmp.Diff(tt.wantBody, body); diff != "" {
+					t.Errorf("body mismatch (-want +got):\n%s", diff)
+				}
+			}
+			if tt.wantPage == nil {
+				return
+			}
+			var got struct {
+				Data       []map[string]any `json:"data"`
+				Total      int              `json:"total"`
+				Page       int              `json:"page"`
+				Limit      int              `json:"limit"`
+				NextCursor string           `json:"nextCursor"`
+			}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			gotPage := page{Names: []string{}, Total: got.Total, Page: got.Page, Limit: got.Limit, NextCursor: got.NextCursor != ""}
+			for _, record := range got.Data {
+				gotPage.Names = append(gotPage.Names, record["name"].(string))
+			}
+			if diff := cmp.Diff(*tt.wantPage, gotPage); diff != "" {
+				t.Errorf("page mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_queryDataset_cursor(t *testing.T) {
+	endpoint := Endpoint{Response: Response{Dataset: &Dataset{File: "testdata/products.csv", DefaultLimit: 2}}}
+	var names []string
+	query := url.Values{}
+	for range 5 {
+		body, _, err := queryDataset(endpoint, "/products", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page struct {
+			Data       []map[string]any `json:"data"`
+			NextCursor string           `json:"nextCursor"`
+		}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range page.Data {
+			names = append(names, record["name"].(string))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if diff := cmp.Diff([]string{"Apple", "Banana", "Cherry", "Durian", "Elderberry"}, names); diff != "" {
+		t.Errorf("cursor pages mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,92 @@
+package stubs
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DelayDistribution describes a random response delay in milliseconds.
+type DelayDistribution struct {
+	Type        string         `json:"type"`                  // uniform, lognormal, percentiles
+	Lower       int            `json:"lower,omitempty"`       // uniform: 最小値
+	Upper       int            `json:"upper,omitempty"`       // uniform: 最大値
+	Median      float64        `json:"median,omitempty"`      // lognormal: 中央値
+	Sigma       float64        `json:"sigma,omitempty"`       // lognormal: 対数の標準偏差
+	MaxValue    float64        `json:"maxValue,omitempty"`    // lognormal: 上限。0 は上限なし
+	Percentiles map[string]int `json:"percentiles,omitempty"` // percentiles: パーセンタイル ("50", "99.9") ごとの遅延。間は線形補間する
+}
+
+// sample draws a delay from the distribution. Unknown types give no delay.
+func (d DelayDistribution) sample() time.Duration {
+	var ms float64
+	switch d.Type {
+	case "uniform":
+		ms = float64(d.Lower)
+		if d.Upper > d.Lower {
+			ms += rand.Float64() * float64(d.Upper-d.Lower)
+		}
+	case "lognormal":
+		ms = d.Median * math.Exp(rand.NormFloat64()*d.Sigma)
+		if d.MaxValue > 0 {
+			ms = math.Min(ms, d.MaxValue)
+		}
+	case "percentiles":
+		ms = d.percentile(rand.Float64() * 100)
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// percentile interpolates the delay at percentile p from the table, starting
+// from no delay at the 0th percentile.
+func (d DelayDistribution) percentile(p float64) float64 {
+	type point struct{ p, ms float64 }
+	points := []point{{0, 0}}
+	for k, v := range d.Percentiles {
+		pk, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			continue
+		}
+		points = append(points, point{pk, float64(v)})
+	}
+	slices.SortFunc(points, func(a, b point) int { return cmp.Compare(a.p, b.p) })
+	for i := 1; i < len(points); i++ {
+		if p <= points[i].p {
+			lo, hi := points[i-1], points[i]
+			if hi.p == lo.p {
+				return hi.ms
+			}
+			return lo.ms + (hi.ms-lo.ms)*(p-lo.p)/(hi.p-lo.p)
+		}
+	}
+	return points[len(points)-1].ms
+}
+
+// responseDelay returns the delay configured for a response.
+func responseDelay(response Response) time.Duration {
+	d := time.Duration(response.FixedDelayMilliseconds) * time.Millisecond
+	if response.DelayDistribution != nil {
+		d += response.DelayDistribution.sample()
+	}
+	return d
+}
+
+// sleepContext waits for d, returning early with the context's error when the
+// client goes away or the server shuts down.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
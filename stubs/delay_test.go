@@ -0,0 +1,98 @@
+package stubs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_responseDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		response Response
+		min, max time.Duration
+	}{
+		{name: "none", response: Response{}, min: 0, max: 0},
+		{name: "fixed", response: Response{FixedDelayMilliseconds: 250}, min: 250 * time.Millisecond, max: 250 * time.Millisecond},
+		{
+			name:     "fixed plus uniform",
+			response: Response{FixedDelayMilliseconds: 100, DelayDistribution: &DelayDistribution{Type: "uniform", Lower: 10, Upper: 20}},
+			min:      110 * time.Millisecond, max: 120 * time.Millisecond,
+		},
+		{
+			name:     "lognormal capped",
+			response: Response{DelayDistribution: &DelayDistribution{Type: "lognormal", Median: 80, Sigma: 2, MaxValue: 300}},
+			min:      0, max: 300 * time.Millisecond,
+		},
+		{
+			name:     "percentiles",
+			response: Response{DelayDistribution: &DelayDistribution{Type: "percentiles", Percentiles: map[string]int{"50": 100, "100": 1000}}},
+			min:      0, max: 1000 * time.Millisecond,
+		},
+		{name: "unknown type", response: Response{DelayDistribution: &DelayDistribution{Type: "gamma"}}, min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 200 {
+				if got := responseDelay(tt.response); got < tt.min || got > tt.max {
+					t.Fatalf("responseDelay() = %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func Test_responseDelay_lognormalMedian(t *testing.T) {
+	response := Response{DelayDistribution: &DelayDistribution{Type: "lognormal", Median: 100, Sigma: 0.5}}
+	samples := make([]time.Duration, 2001)
+	for i := range samples {
+		samples[i] = responseDelay(response)
+	}
+	slices.Sort(samples)
+	if median := samples[len(samples)/2]; median < 85*time.Millisecond || median > 115*time.Millisecond {
+		t.Errorf("median of lognormal delays = %s, want about 100ms", median)
+	}
+}
+
+func Test_DelayDistribution_percentile(t *testing.T) {
+	d := DelayDistribution{Type: "percentiles", Percentiles: map[string]int{"50": 100, "90": 500, "99.9": 2000}}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{p: 0, want: 0},
+		{p: 25, want: 50},
+		{p: 50, want: 100},
+		{p: 70, want: 300},
+		{p: 90, want: 500},
+		{p: 99.9, want: 2000},
+		{p: 100, want: 2000},
+	}
+	for _, tt := range tests {
+		if got := d.percentile(tt.p); got < tt.want-0.001 || got > tt.want+0.001 {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func Test_sleepContext(t *testing.T) {
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("sleepContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	err := sleepContext(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("sleepContext() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleepContext() returned after %s, want right after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,84 @@
+package stubs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ChunkedDribbleDelay sends the body in chunks spread evenly over a duration.
+type ChunkedDribbleDelay struct {
+	NumberOfChunks int `json:"numberOfChunks"`
+	TotalDuration  int `json:"totalDuration"` // ミリ秒
+}
+
+// writeBody writes the body, dribbling and throttling it as configured. Chunks
+// are flushed as they are written.
+func writeBody(ctx context.Context, w http.ResponseWriter, response Response, body []byte) error {
+	var out io.Writer = w
+	if response.BytesPerSecond > 0 {
+		out = &throttledWriter{ctx: ctx, w: w, rate: response.BytesPerSecond, start: time.Now()}
+	}
+	d := response.ChunkedDribbleDelay
+	if d == nil || d.NumberOfChunks <= 1 || len(body) == 0 {
+		_, err := out.Write(body)
+		return err
+	}
+
+	chunks := min(d.NumberOfChunks, len(body))
+	total := time.Duration(d.TotalDuration) * time.Millisecond
+	rc := http.NewResponseController(w)
+	start := time.Now()
+	for i := range chunks {
+		// the first chunk goes out at once and the last at totalDuration; each
+		// is due from the start so the waits don't add up their overhead
+		due := start.Add(total * time.Duration(i) / time.Duration(chunks-1))
+		if err := sleepContext(ctx, time.Until(due)); err != nil {
+			return err
+		}
+		chunk := body[i*len(body)/chunks : (i+1)*len(body)/chunks]
+		if _, err := out.Write(chunk); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttledWriter limits the bytes written per second, flushing every write.
+type throttledWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	rate    int
+	start   time.Time
+	written int
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	rc := http.NewResponseController(t.w)
+	// a tenth of the rate at a time keeps the delivery smooth
+	step := max(t.rate/10, 1)
+	n := 0
+	for n < len(p) {
+		end := min(n+step, len(p))
+		// wait until the link would have carried the bytes so far plus this step
+		due := t.start.Add(time.Duration(float64(t.written+end-n) / float64(t.rate) * float64(time.Second)))
+		if err := sleepContext(t.ctx, time.Until(due)); err != nil {
+			return n, err
+		}
+		m, err := t.w.Write(p[n:end])
+		n += m
+		t.written += m
+		if err != nil {
+			return n, err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package stubs
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_writeBody(t *testing.T) {
+	body := strings.Repeat("0123456789", 20)
+	// time allowed beyond the configured duration for scheduling
+	const slack = 100 * time.Millisecond
+	tests := []struct {
+		name     string
+		response Response
+		duration time.Duration
+	}{
+		{name: "plain", response: Response{}},
+		{name: "dribble", response: Response{ChunkedDribbleDelay: &ChunkedDribbleDelay{NumberOfChunks: 4, TotalDuration: 200}}, duration: 200 * time.Millisecond},
+		{name: "more chunks than bytes", response: Response{ChunkedDribbleDelay: &ChunkedDribbleDelay{NumberOfChunks: 1000, TotalDuration: 100}}, duration: 100 * time.Millisecond},
+		{name: "throttle", response: Response{BytesPerSecond: 1000}, duration: 200 * time.Millisecond},
+		{name: "dribble and throttle", response: Response{BytesPerSecond: 2000, ChunkedDribbleDelay: &ChunkedDribbleDelay{NumberOfChunks: 2, TotalDuration: 20}}, duration: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			if err := writeBody(context.Background(), rec, tt.response, []byte(body)); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.duration || elapsed > tt.duration+slack {
+				t.Errorf("writeBody() took %s, want %s", elapsed, tt.duration)
+			}
+			if got := rec.Body.String(); got != body {
+				t.Errorf("writeBody() wrote %q, want %q", got, body)
+			}
+			if tt.duration > 0 && !rec.Flushed {
+				t.Error("writeBody() did not flush")
+			}
+		})
+	}
+}
+
+func Test_writeBody_canceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	response := Response{ChunkedDribbleDelay: &ChunkedDribbleDelay{NumberOfChunks: 2, TotalDuration: 60000}}
+	err := writeBody(ctx, rec, response, []byte("first half|second half"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("writeBody() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := rec.Body.String(); got != "first half|" {
+		t.Errorf("writeBody() wrote %q before cancellation", got)
+	}
+}
@@ -0,0 +1,414 @@
+package stubs
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseJSONBody decodes a JSON request body for templates. Bodies that are not
+// JSON decode to an empty object.
+func parseJSONBody(body []byte) any {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil || v == nil {
+		return map[string]any{}
+	}
+	return v
+}
+
+func bodyText(body any) string {
+	switch b := body.(type) {
+	case string:
+		return b
+	case []byte:
+		return string(b)
+	}
+	return fmt.Sprint(body)
+}
+
+// jsonPath evaluates a JSONPath expression ($.a.b[0], $['a'], $.items[*].id,
+// $..id) against a JSON body or an already decoded value. Missing values and
+// bodies that are not JSON give an empty string.
+func jsonPath(body any, expr string) (string, error) {
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		return "", err
+	}
+	var root any
+	switch b := body.(type) {
+	case string, []byte:
+		root = parseJSONBody([]byte(bodyText(b)))
+	default:
+		root = b
+	}
+
+	nodes := []any{root}
+	multiple := false
+	for _, s := range steps {
+		var next []any
+		for _, n := range nodes {
+			if s.recursive {
+				for _, d := range jsonDescendants(n) {
+					next = append(next, jsonChildren(d, s)...)
+				}
+			} else {
+				next = append(next, jsonChildren(n, s)...)
+			}
+		}
+		multiple = multiple || s.recursive || s.wildcard
+		nodes = next
+	}
+	if multiple {
+		if nodes == nil {
+			nodes = []any{}
+		}
+		return valueString(nodes), nil
+	}
+	if len(nodes) == 0 || nodes[0] == nil {
+		return "", nil
+	}
+	return valueString(nodes[0]), nil
+}
+
+type jsonPathStep struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	s, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+	var steps []jsonPathStep
+	for s != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.recursive = true
+			s = s[2:]
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+		case strings.HasPrefix(s, "["):
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q", expr)
+		}
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				step.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				step.key = inner[1 : len(inner)-1]
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad index %q", expr, inner)
+				}
+				step.index, step.isIndex = i, true
+			}
+		} else {
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			step.key, s = s[:end], s[end:]
+			if step.key == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty name", expr)
+			}
+			if step.key == "*" {
+				step.key, step.wildcard = "", true
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func jsonChildren(n any, s jsonPathStep) []any {
+	switch v := n.(type) {
+	case map[string]any:
+		if s.wildcard {
+			children := make([]any, 0, len(v))
+			for _, k := range sortedKeys(v) {
+				children = append(children, v[k])
+			}
+			return children
+		}
+		if c, ok := v[s.key]; ok && !s.isIndex {
+			return []any{c}
+		}
+	case []any:
+		if s.wildcard {
+			return v
+		}
+		if s.isIndex {
+			i := s.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []any{v[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonDescendants returns n and all values nested in it, in document order.
+func jsonDescendants(n any) []any {
+	nodes := []any{n}
+	switch v := n.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			nodes = append(nodes, jsonDescendants(v[k])...)
+		}
+	case []any:
+		for _, c := range v {
+			nodes = append(nodes, jsonDescendants(c)...)
+		}
+	}
+	return nodes
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder // 直下のテキスト
+	content  strings.Builder // 子孫を含むテキスト
+}
+
+func parseXMLTree(body string) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	d := xml.NewDecoder(strings.NewReader(body))
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: t.Attr}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+			for _, n := range stack {
+				n.content.Write(t)
+			}
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, errors.New("no XML element")
+	}
+	return root, nil
+}
+
+type xpathStep struct {
+	name       string // ローカル名。* はすべての要素
+	descendant bool
+	attr       string
+	text       bool
+	index      int // 1 始まり。0 は指定なし
+	attrName   string
+	attrValue  string
+}
+
+// xPath evaluates a subset of XPath (/a/b, //b, *, [n], [@attr='v'], @attr,
+// text()) against an XML body and returns the text of the first match. Names
+// are compared without namespaces, so /soap:Envelope/soap:Body works whatever
+// prefix the client chose.
+func xPath(body any, expr string) (string, error) {
+	steps, err := parseXPath(expr)
+	if err != nil {
+		return "", err
+	}
+	root, err := parseXMLTree(bodyText(body))
+	if err != nil {
+		return "", nil
+	}
+	nodes := []*xmlNode{root}
+	for _, s := range steps {
+		switch {
+		case s.attr != "":
+			for _, n := range nodes {
+				for _, a := range n.attrs {
+					if a.Name.Local == s.attr {
+						return a.Value, nil
+					}
+				}
+			}
+			return "", nil
+		case s.text:
+			if len(nodes) == 0 {
+				return "", nil
+			}
+			return nodes[0].text.String(), nil
+		}
+		var next []*xmlNode
+		for _, n := range nodes {
+			var candidates []*xmlNode
+			if s.descendant {
+				candidates = xmlDescendants(n)
+			} else {
+				candidates = n.children
+			}
+			var matched []*xmlNode
+			for _, c := range candidates {
+				if s.name != "*" && c.name.Local != s.name {
+					continue
+				}
+				if s.attrName != "" && !hasXMLAttr(c, s.attrName, s.attrValue) {
+					continue
+				}
+				matched = append(matched, c)
+			}
+			if s.index > 0 {
+				if s.index > len(matched) {
+					continue
+				}
+				matched = matched[s.index-1 : s.index]
+			}
+			next = append(next, matched...)
+		}
+		nodes = next
+	}
+	if len(nodes) == 0 {
+		return "", nil
+	}
+	return strings.TrimSpace(nodes[0].content.String()), nil
+}
+
+func parseXPath(expr string) ([]xpathStep, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("XPath %q must be absolute", expr)
+	}
+	var steps []xpathStep
+	for s != "" {
+		var step xpathStep
+		switch {
+		case strings.HasPrefix(s, "//"):
+			step.descendant = true
+			s = s[2:]
+		case strings.HasPrefix(s, "/"):
+			s = s[1:]
+		default:
+			return nil, fmt.Errorf("invalid XPath %q", expr)
+		}
+		end := len(s)
+		depth := 0
+	scan:
+		for i, r := range s {
+			switch r {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			case '/':
+				if depth == 0 {
+					end = i
+					break scan
+				}
+			}
+		}
+		token := s[:end]
+		s = s[end:]
+
+		name, predicate, hasPredicate := strings.Cut(token, "[")
+		if name == "" {
+			return nil, fmt.Errorf("invalid XPath %q: empty step", expr)
+		}
+		switch {
+		case strings.HasPrefix(name, "@"):
+			step.attr = localName(name[1:])
+		case name == "text()":
+			step.text = true
+		default:
+			step.name = localName(name)
+		}
+		if hasPredicate {
+			predicate, ok := strings.CutSuffix(predicate, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid XPath %q: missing ]", expr)
+			}
+			if attr, ok := strings.CutPrefix(predicate, "@"); ok {
+				k, v, ok := strings.Cut(attr, "=")
+				v = strings.TrimSpace(v)
+				if !ok || len(v) < 2 || (v[0] != '\'' && v[0] != '"') || v[len(v)-1] != v[0] {
+					return nil, fmt.Errorf("invalid XPath %q: unsupported predicate [%s]", expr, predicate)
+				}
+				step.attrName, step.attrValue = localName(strings.TrimSpace(k)), v[1:len(v)-1]
+			} else {
+				i, err := strconv.Atoi(strings.TrimSpace(predicate))
+				if err != nil || i < 1 {
+					return nil, fmt.Errorf("invalid XPath %q: unsupported predicate [%s]", expr, predicate)
+				}
+				step.index = i
+			}
+		}
+		if (step.attr != "" || step.text) && s != "" {
+			return nil, fmt.Errorf("invalid XPath %q: %s must be the last step", expr, name)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func xmlDescendants(n *xmlNode) []*xmlNode {
+	var nodes []*xmlNode
+	for _, c := range n.children {
+		nodes = append(nodes, c)
+		nodes = append(nodes, xmlDescendants(c)...)
+	}
+	return nodes
+}
+
+func hasXMLAttr(n *xmlNode, name, value string) bool {
+	for _, a := range n.attrs {
+		if a.Name.Local == name && a.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// formValue returns a field of an application/x-www-form-urlencoded body.
+func formValue(body any, name string) string {
+	values, _ := url.ParseQuery(bodyText(body))
+	return values.Get(name)
+}
@@ -0,0 +1,124 @@
+package stubs
+
+import (
+	"testing"
+)
+
+func Test_jsonPath(t *testing.T) {
+	body := `{"sku": "A-1", "qty": 2, "price": 1.5, "customer": {"name": "Jane", "tags": ["vip", "new"]},
+		"items": [{"id": 1}, {"id": 2}], "odd key": true, "none": null}`
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "field", expr: "$.sku", want: "A-1"},
+		{name: "number", expr: "$.qty", want: "2"},
+		{name: "nested", expr: "$.customer.name", want: "Jane"},
+		{name: "index", expr: "$.customer.tags[1]", want: "new"},
+		{name: "negative index", expr: "$.customer.tags[-1]", want: "new"},
+		{name: "bracket", expr: "$['odd key']", want: "true"},
+		{name: "object", expr: "$.items[0]", want: `{"id":1}`},
+		{name: "wildcard", expr: "$.items[*].id", want: "[1,2]"},
+		{name: "recursive", expr: "$..id", want: "[1,2]"},
+		{name: "missing", expr: "$.nothing.here", want: ""},
+		{name: "null", expr: "$.none", want: ""},
+		{name: "no $", expr: "sku", wantErr: true},
+		{name: "bad index", expr: "$.items[x]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonPath(body, tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("jsonPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("jsonPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := jsonPath("not json", "$.sku"); got != "" {
+		t.Errorf("jsonPath() on a non-JSON body = %q, want empty", got)
+	}
+	if got, _ := jsonPath(map[string]any{"a": "b"}, "$.a"); got != "b" {
+		t.Errorf("jsonPath() on a decoded value = %q, want b", got)
+	}
+}
+
+func Test_xPath(t *testing.T) {
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <q:GetQuote xmlns:q="urn:quotes" currency="USD">
+      <symbol>ACME</symbol>
+      <symbol>INIT</symbol>
+      <item type="a">first</item>
+      <item type="b">second</item>
+    </q:GetQuote>
+  </soap:Body>
+</soap:Envelope>`
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "absolute", expr: "/Envelope/Body/GetQuote/symbol", want: "ACME"},
+		{name: "prefixed", expr: "/soap:Envelope/soap:Body/q:GetQuote/symbol", want: "ACME"},
+		{name: "descendant", expr: "//symbol", want: "ACME"},
+		{name: "index", expr: "//symbol[2]", want: "INIT"},
+		{name: "attribute predicate", expr: "//item[@type='b']", want: "second"},
+		{name: "attribute", expr: "//GetQuote/@currency", want: "USD"},
+		{name: "text", expr: "//item/text()", want: "first"},
+		{name: "wildcard", expr: "/Envelope/*/GetQuote/item", want: "first"},
+		{name: "missing", expr: "//price", want: ""},
+		{name: "relative", expr: "symbol", wantErr: true},
+		{name: "bad predicate", expr: "//item[last()]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xPath(body, tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("xPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("xPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formValue(t *testing.T) {
+	body := "name=Jane+Doe&email=jane%40example.com&tag=a&tag=b"
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{name: "decoded", field: "name", want: "Jane Doe"},
+		{name: "escaped", field: "email", want: "jane@example.com"},
+		{name: "first of many", field: "tag", want: "a"},
+		{name: "missing", field: "age", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formValue(body, tt.field); got != tt.want {
+				t.Errorf("formValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_renderTemplate_body(t *testing.T) {
+	body := []byte(`{"sku": "A-1", "qty": 3}`)
+	gp := TemplateData{Body: string(body), JSON: parseJSONBody(body)}
+	got, err := renderTemplate(`{"sku": "{{jsonPath .Body "$.sku"}}", "qty": {{.JSON.qty}}, "raw": {{toJson .Body}}}`, gp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"sku": "A-1", "qty": 3, "raw": "{\"sku\": \"A-1\", \"qty\": 3}"}`
+	if got != want {
+		t.Errorf("renderTemplate() = %q, want %q", got, want)
+	}
+}
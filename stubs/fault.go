@@ -0,0 +1,97 @@
+package stubs
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Faults that break the connection instead of answering.
+const (
+	faultConnectionReset = "CONNECTION_RESET_BY_PEER" // RST で切断する
+	faultEmptyResponse   = "EMPTY_RESPONSE"           // 何も返さずに切断する
+	faultRandomData      = "RANDOM_DATA_THEN_CLOSE"   // ランダムなバイト列を送って切断する
+	faultTruncatedBody   = "TRUNCATED_BODY"           // Content-Length より短いボディを送って切断する
+	faultMalformedChunk  = "MALFORMED_RESPONSE_CHUNK" // 壊れた chunked エンコーディングを送って切断する
+	faultHang            = "HANG"                     // クライアントが諦めるまで何も返さない
+)
+
+func validFault(fault string) bool {
+	switch fault {
+	case faultConnectionReset, faultEmptyResponse, faultRandomData, faultTruncatedBody, faultMalformedChunk, faultHang:
+		return true
+	}
+	return false
+}
+
+// injectFault breaks the response as configured. The connection is hijacked
+// where the protocol allows it; HTTP/2 streams are reset instead.
+func injectFault(w http.ResponseWriter, r *http.Request, fault string, response *TransformedResponse) error {
+	if !validFault(fault) {
+		return fmt.Errorf("unknown fault %q", fault)
+	}
+	if fault == faultHang {
+		<-r.Context().Done()
+		panic(http.ErrAbortHandler)
+	}
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		panic(http.ErrAbortHandler)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch fault {
+	case faultConnectionReset:
+		resetConnection(conn)
+		return nil
+	case faultEmptyResponse:
+		return nil
+	case faultRandomData:
+		garbage := make([]byte, 1024)
+		_, _ = rand.Read(garbage)
+		_, err = buf.Write(garbage)
+	case faultTruncatedBody:
+		length := max(len(response.Body), 1)
+		response.Header.Set("Content-Length", strconv.Itoa(length))
+		writeRawHeader(buf, response)
+		_, err = buf.Write(response.Body[:len(response.Body)/2])
+	case faultMalformedChunk:
+		response.Header.Del("Content-Length")
+		response.Header.Set("Transfer-Encoding", "chunked")
+		writeRawHeader(buf, response)
+		half := response.Body[:len(response.Body)/2]
+		if len(half) > 0 {
+			fmt.Fprintf(buf, "%x\r\n%s\r\n", len(half), half)
+		}
+		_, err = buf.WriteString("zz\r\nnot a chunk")
+	}
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// resetConnection closes the connection with an RST instead of a FIN.
+func resetConnection(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+func writeRawHeader(buf *bufio.ReadWriter, response *TransformedResponse) {
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", response.Status, http.StatusText(response.Status))
+	_ = response.Header.Write(buf)
+	_, _ = buf.WriteString("\r\n")
+}
@@ -0,0 +1,62 @@
+package stubs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_injectFault(t *testing.T) {
+	tests := []struct {
+		fault string
+		// wantErr reports whether the client error is the expected one
+		wantErr func(err error) bool
+	}{
+		{fault: "CONNECTION_RESET_BY_PEER", wantErr: func(err error) bool { return err != nil }},
+		{fault: "EMPTY_RESPONSE", wantErr: func(err error) bool { return errors.Is(err, io.EOF) || strings.Contains(err.Error(), "EOF") }},
+		{fault: "RANDOM_DATA_THEN_CLOSE", wantErr: func(err error) bool { return err != nil }},
+		{fault: "TRUNCATED_BODY", wantErr: func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{fault: "MALFORMED_RESPONSE_CHUNK", wantErr: func(err error) bool { return err != nil && strings.Contains(err.Error(), "chunk") }},
+		{fault: "HANG", wantErr: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fault, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := &TransformedResponse{
+					Status: http.StatusOK,
+					Header: http.Header{"Content-Type": {"application/json"}},
+					Body:   []byte(`{"message": "this body never arrives intact"}`),
+				}
+				if err := injectFault(w, r, tt.fault, response); err != nil {
+					t.Errorf("injectFault() error = %v", err)
+				}
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			res, err := http.DefaultClient.Do(req)
+			if err == nil {
+				_, err = io.ReadAll(res.Body)
+				res.Body.Close()
+			}
+			if err == nil || !tt.wantErr(err) {
+				t.Errorf("client error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_injectFault_unknown(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := injectFault(rec, req, "SLOW_LORIS", &TransformedResponse{}); err == nil {
+		t.Error("injectFault() error = nil, want an error for an unknown fault")
+	}
+}
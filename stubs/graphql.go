@@ -0,0 +1,595 @@
+package stubs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GraphQLRequest matches a GraphQL operation sent as JSON body or as query parameters.
+type GraphQLRequest struct {
+	OperationName Matcher            `json:"operationName,omitzero"`
+	OperationType string             `json:"operationType,omitempty"` // query, mutation, subscription
+	Query         string             `json:"query,omitempty"`         // 空白やフィールド順序を無視して比較するクエリドキュメント
+	Variables     map[string]Matcher `json:"variables,omitempty"`     // 変数名 (ドット区切りでネスト可) ごとのマッチャー
+}
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Path       []any             `json:"path,omitempty"`
+	Extensions map[string]any    `json:"extensions,omitempty"`
+}
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// graphqlParams is the GraphQL over HTTP request payload.
+type graphqlParams struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func graphqlMatcher(endpoint Endpoint, gotQuery url.Values, body string) bool {
+	g := endpoint.Request.GraphQL
+	if g == nil {
+		return true
+	}
+	params, err := parseGraphQLParams(gotQuery, body)
+	if err != nil {
+		return false
+	}
+	definitions, err := parseGraphQLDocument(params.Query)
+	if err != nil {
+		return false
+	}
+	operation, ok := selectGraphQLOperation(definitions, params.OperationName)
+	if !ok {
+		return false
+	}
+	if !valueMatcher(g.OperationName, operation.name) {
+		return false
+	}
+	if g.OperationType != "" && g.OperationType != operation.kind {
+		return false
+	}
+	if g.Query != "" {
+		want, err := normalizeGraphQL(g.Query)
+		if err != nil {
+			return false
+		}
+		if got := joinGraphQLDefinitions(definitions); got != want {
+			return false
+		}
+	}
+	for name, m := range g.Variables {
+		value, ok := lookupPath(params.Variables, name)
+		if !ok {
+			value = ""
+		}
+		if !valueMatcher(m, valueString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGraphQLParams reads the operation from a JSON body, falling back to the
+// query parameters used by GET requests.
+func parseGraphQLParams(gotQuery url.Values, body string) (graphqlParams, error) {
+	var params graphqlParams
+	if strings.TrimSpace(body) != "" {
+		d := json.NewDecoder(strings.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&params); err != nil {
+			return params, err
+		}
+		return params, nil
+	}
+	params.Query = gotQuery.Get("query")
+	params.OperationName = gotQuery.Get("operationName")
+	if v := gotQuery.Get("variables"); v != "" {
+		d := json.NewDecoder(strings.NewReader(v))
+		d.UseNumber()
+		if err := d.Decode(&params.Variables); err != nil {
+			return params, err
+		}
+	}
+	if params.Query == "" {
+		return params, errors.New("missing query")
+	}
+	return params, nil
+}
+
+// selectGraphQLOperation picks the executed operation as described by the spec:
+// the one named operationName, or the only operation of the document.
+func selectGraphQLOperation(definitions []graphqlDefinition, operationName string) (graphqlDefinition, bool) {
+	var operations []graphqlDefinition
+	for _, d := range definitions {
+		if d.kind != "fragment" {
+			operations = append(operations, d)
+		}
+	}
+	if operationName == "" {
+		if len(operations) != 1 {
+			return graphqlDefinition{}, false
+		}
+		return operations[0], true
+	}
+	for _, o := range operations {
+		if o.name == operationName {
+			return o, true
+		}
+	}
+	return graphqlDefinition{}, false
+}
+
+// graphqlErrorBody wraps the response body as data next to the configured errors.
+func graphqlErrorBody(graphqlErrors []GraphQLError, body string) (string, error) {
+	var errs strings.Builder
+	enc := json.NewEncoder(&errs)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(graphqlErrors); err != nil {
+		return "", err
+	}
+	// data is spliced in as text so that it can still be a template
+	data := strings.TrimSpace(body)
+	if data == "" {
+		data = "null"
+	}
+	return `{"errors":` + strings.TrimSuffix(errs.String(), "\n") + `,"data":` + data + "}\n", nil
+}
+
+// normalizeGraphQL returns a canonical form of a GraphQL document that ignores
+// whitespace, commas, comments and the order of fields, arguments and definitions.
+func normalizeGraphQL(document string) (string, error) {
+	definitions, err := parseGraphQLDocument(document)
+	if err != nil {
+		return "", err
+	}
+	return joinGraphQLDefinitions(definitions), nil
+}
+
+func joinGraphQLDefinitions(definitions []graphqlDefinition) string {
+	texts := make([]string, 0, len(definitions))
+	for _, d := range definitions {
+		texts = append(texts, d.text)
+	}
+	slices.Sort(texts)
+	return strings.Join(texts, " ")
+}
+
+type graphqlDefinition struct {
+	kind string // query, mutation, subscription, fragment
+	name string
+	text string // canonical text
+}
+
+type graphqlToken struct {
+	kind  byte // 'p' punctuator, 'n' name, 'v' number, 's' string
+	value string
+}
+
+func lexGraphQL(src string) ([]graphqlToken, error) {
+	var tokens []graphqlToken
+	src = strings.TrimPrefix(src, "\ufeff")
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, graphqlToken{'p', "..."})
+			i += 3
+		case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+			tokens = append(tokens, graphqlToken{'p', string(c)})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, graphqlToken{'n', src[i:j]})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, graphqlToken{'v', src[i:j]})
+			i = j
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			for end >= 0 && strings.HasSuffix(src[i+3:i+3+end], `\`) {
+				next := strings.Index(src[i+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return nil, errors.New("unterminated block string")
+			}
+			tokens = append(tokens, graphqlToken{'s', strconv.Quote(blockStringValue(src[i+3 : i+3+end]))})
+			i += 3 + end + 3
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			value, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				// GraphQL escapes are a subset of Go's except \u{...}; keep the raw text
+				value = src[i+1 : j]
+			}
+			tokens = append(tokens, graphqlToken{'s', strconv.Quote(value)})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// blockStringValue strips the common indentation and blank edge lines of a block string.
+func blockStringValue(raw string) string {
+	raw = strings.ReplaceAll(raw, `\"""`, `"""`)
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		lines[i] = lines[i][min(indent, len(lines[i])):]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type graphqlParser struct {
+	tokens []graphqlToken
+	pos    int
+}
+
+func parseGraphQLDocument(document string) ([]graphqlDefinition, error) {
+	tokens, err := lexGraphQL(document)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty document")
+	}
+	p := &graphqlParser{tokens: tokens}
+	var definitions []graphqlDefinition
+	for !p.done() {
+		d, err := p.definition()
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, nil
+}
+
+func (p *graphqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *graphqlParser) peek(value string) bool {
+	return !p.done() && p.tokens[p.pos].kind != 's' && p.tokens[p.pos].value == value
+}
+
+func (p *graphqlParser) next() (graphqlToken, error) {
+	if p.done() {
+		return graphqlToken{}, errors.New("unexpected end of document")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *graphqlParser) expect(value string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind == 's' || t.value != value {
+		return fmt.Errorf("expected %q, got %q", value, t.value)
+	}
+	return nil
+}
+
+func (p *graphqlParser) name() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind != 'n' {
+		return "", fmt.Errorf("expected name, got %q", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *graphqlParser) definition() (graphqlDefinition, error) {
+	if p.peek("{") {
+		set, err := p.selectionSet()
+		if err != nil {
+			return graphqlDefinition{}, err
+		}
+		return graphqlDefinition{kind: "query", text: "query " + set}, nil
+	}
+	kind, err := p.name()
+	if err != nil {
+		return graphqlDefinition{}, err
+	}
+	parts := []string{kind}
+	d := graphqlDefinition{kind: kind}
+	switch kind {
+	case "fragment":
+		if d.name, err = p.name(); err != nil {
+			return d, err
+		}
+		if err := p.expect("on"); err != nil {
+			return d, err
+		}
+		typeName, err := p.name()
+		if err != nil {
+			return d, err
+		}
+		parts = append(parts, d.name, "on", typeName)
+	case "query", "mutation", "subscription":
+		if !p.done() && p.tokens[p.pos].kind == 'n' {
+			d.name, _ = p.name()
+			parts = append(parts, d.name)
+		}
+		if p.peek("(") {
+			variables, err := p.group("(", ")")
+			if err != nil {
+				return d, err
+			}
+			parts = append(parts, variables)
+		}
+	default:
+		return d, fmt.Errorf("unsupported definition %q", kind)
+	}
+	directives, err := p.directives()
+	if err != nil {
+		return d, err
+	}
+	set, err := p.selectionSet()
+	if err != nil {
+		return d, err
+	}
+	d.text = strings.Join(append(append(parts, directives...), set), " ")
+	return d, nil
+}
+
+// group returns the tokens up to the matching close punctuator, in their original order.
+func (p *graphqlParser) group(open, close string) (string, error) {
+	if err := p.expect(open); err != nil {
+		return "", err
+	}
+	parts := []string{open}
+	for depth := 1; depth > 0; {
+		t, err := p.next()
+		if err != nil {
+			return "", err
+		}
+		if t.kind == 'p' && t.value == open {
+			depth++
+		} else if t.kind == 'p' && t.value == close {
+			depth--
+		}
+		parts = append(parts, t.value)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (p *graphqlParser) selectionSet() (string, error) {
+	if err := p.expect("{"); err != nil {
+		return "", err
+	}
+	var selections []string
+	for !p.peek("}") {
+		if p.done() {
+			return "", errors.New("unterminated selection set")
+		}
+		s, err := p.selection()
+		if err != nil {
+			return "", err
+		}
+		selections = append(selections, s)
+	}
+	p.pos++
+	slices.Sort(selections)
+	return "{ " + strings.Join(selections, " ") + " }", nil
+}
+
+func (p *graphqlParser) selection() (string, error) {
+	var parts []string
+	if p.peek("...") {
+		p.pos++
+		parts = append(parts, "...")
+		if p.peek("on") || p.peek("{") || p.peek("@") {
+			if p.peek("on") {
+				p.pos++
+				typeName, err := p.name()
+				if err != nil {
+					return "", err
+				}
+				parts = append(parts, "on", typeName)
+			}
+			directives, err := p.directives()
+			if err != nil {
+				return "", err
+			}
+			set, err := p.selectionSet()
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(append(append(parts, directives...), set), " "), nil
+		}
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		directives, err := p.directives()
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(append(append(parts, name), directives...), " "), nil
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return "", err
+	}
+	if p.peek(":") {
+		p.pos++
+		field, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		name = name + " : " + field
+	}
+	parts = append(parts, name)
+	if p.peek("(") {
+		arguments, err := p.arguments()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, arguments)
+	}
+	directives, err := p.directives()
+	if err != nil {
+		return "", err
+	}
+	parts = append(parts, directives...)
+	if p.peek("{") {
+		set, err := p.selectionSet()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, set)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (p *graphqlParser) directives() ([]string, error) {
+	var directives []string
+	for p.peek("@") {
+		p.pos++
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		directive := "@ " + name
+		if p.peek("(") {
+			arguments, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			directive += " " + arguments
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// arguments returns "( name : value ... )" with the arguments sorted by name.
+func (p *graphqlParser) arguments() (string, error) {
+	fields, err := p.fields("(", ")")
+	if err != nil {
+		return "", err
+	}
+	return "( " + strings.Join(fields, " ") + " )", nil
+}
+
+func (p *graphqlParser) fields(open, close string) ([]string, error) {
+	if err := p.expect(open); err != nil {
+		return nil, err
+	}
+	var fields []string
+	for !p.peek(close) {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, name+" : "+value)
+	}
+	p.pos++
+	slices.Sort(fields)
+	return fields, nil
+}
+
+func (p *graphqlParser) value() (string, error) {
+	switch {
+	case p.peek("$"):
+		p.pos++
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		return "$ " + name, nil
+	case p.peek("{"):
+		fields, err := p.fields("{", "}")
+		if err != nil {
+			return "", err
+		}
+		return "{ " + strings.Join(fields, " ") + " }", nil
+	case p.peek("["):
+		p.pos++
+		parts := []string{"["}
+		for !p.peek("]") {
+			v, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, v)
+		}
+		p.pos++
+		return strings.Join(append(parts, "]"), " "), nil
+	}
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind == 'p' {
+		return "", fmt.Errorf("unexpected %q in value", t.value)
+	}
+	return t.value, nil
+}
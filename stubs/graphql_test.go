@@ -0,0 +1,166 @@
+package stubs
+
+import (
+	"net/url"
+	"testing"
+)
+
+func Test_normalizeGraphQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		a         string
+		b         string
+		wantEqual bool
+	}{
+		{
+			name:      "whitespace and commas",
+			a:         "query GetUser($id: ID!) { user(id: $id) { id, name } }",
+			b:         "query GetUser( $id : ID! ) {\n  user(id: $id) {\n    id\n    name\n  }\n}",
+			wantEqual: true,
+		},
+		{
+			name:      "field and argument order",
+			a:         `{ user(id: 1, lang: "en") { name id posts(first: 10) { title } } }`,
+			b:         `{ user(lang: "en", id: 1) { id posts(first: 10) { title } name } }`,
+			wantEqual: true,
+		},
+		{
+			name:      "comments and shorthand query",
+			a:         "# fetch the viewer\n{ viewer { login } }",
+			b:         "query { viewer { login } }",
+			wantEqual: true,
+		},
+		{
+			name:      "fragments",
+			a:         "query Q { ...F } fragment F on User { id name }",
+			b:         "fragment F on User { name id }\nquery Q { ...F }",
+			wantEqual: true,
+		},
+		{
+			name:      "different argument value",
+			a:         "{ user(id: 1) { id } }",
+			b:         "{ user(id: 2) { id } }",
+			wantEqual: false,
+		},
+		{
+			name:      "different field",
+			a:         "{ user { id } }",
+			b:         "{ user { id email } }",
+			wantEqual: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := normalizeGraphQL(tt.a)
+			if err != nil {
+				t.Fatalf("normalizeGraphQL(a) error = %v", err)
+			}
+			b, err := normalizeGraphQL(tt.b)
+			if err != nil {
+				t.Fatalf("normalizeGraphQL(b) error = %v", err)
+			}
+			if (a == b) != tt.wantEqual {
+				t.Errorf("normalizeGraphQL() a = %q, b = %q, want equal %v", a, b, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func Test_graphqlMatcher(t *testing.T) {
+	const body = `{"query": "mutation AddItem($cart: ID!, $item: ItemInput!) { addItem(cart: $cart, item: $item) { id } }", "operationName": "AddItem", "variables": {"cart": "c-1", "item": {"sku": "ABC", "qty": 2}}}`
+	type args struct {
+		graphql  *GraphQLRequest
+		gotQuery url.Values
+		body     string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "no graphql section",
+			args: args{body: "not graphql"},
+			want: true,
+		},
+		{
+			name: "all",
+			args: args{
+				graphql: &GraphQLRequest{
+					OperationName: Matcher{EqualTo: "AddItem"},
+					OperationType: "mutation",
+					Query:         "mutation AddItem($cart: ID!, $item: ItemInput!) {\n  addItem(item: $item, cart: $cart) {\n    id\n  }\n}",
+					Variables: map[string]Matcher{
+						"cart":     {EqualTo: "c-1"},
+						"item.sku": {Matches: "^[A-Z]+$"},
+						"item.qty": {EqualTo: 2},
+					},
+				},
+				body: body,
+			},
+			want: true,
+		},
+		{
+			name: "operation type false",
+			args: args{
+				graphql: &GraphQLRequest{OperationType: "query"},
+				body:    body,
+			},
+			want: false,
+		},
+		{
+			name: "operation name false",
+			args: args{
+				graphql: &GraphQLRequest{OperationName: Matcher{EqualTo: "RemoveItem"}},
+				body:    body,
+			},
+			want: false,
+		},
+		{
+			name: "variables false",
+			args: args{
+				graphql: &GraphQLRequest{Variables: map[string]Matcher{"item.qty": {EqualTo: 3}}},
+				body:    body,
+			},
+			want: false,
+		},
+		{
+			name: "query false",
+			args: args{
+				graphql: &GraphQLRequest{Query: "mutation AddItem { addItem { id name } }"},
+				body:    body,
+			},
+			want: false,
+		},
+		{
+			name: "get request",
+			args: args{
+				graphql: &GraphQLRequest{
+					OperationType: "query",
+					Variables:     map[string]Matcher{"id": {EqualTo: "42"}},
+				},
+				gotQuery: url.Values{
+					"query":     []string{"query User($id: ID) { user(id: $id) { name } }"},
+					"variables": []string{`{"id": "42"}`},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "invalid body",
+			args: args{
+				graphql: &GraphQLRequest{},
+				body:    "{",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := Endpoint{Request: Request{GraphQL: tt.args.graphql}}
+			if got := graphqlMatcher(endpoint, tt.args.gotQuery, tt.args.body); got != tt.want {
+				t.Errorf("graphqlMatcher() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
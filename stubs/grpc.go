@@ -0,0 +1,322 @@
+package stubs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCRequest matches a gRPC call on its method and request message.
+type GRPCRequest struct {
+	Service string             `json:"service,omitempty"` // パッケージを含むサービス名 (例: helloworld.Greeter)
+	Method  string             `json:"method,omitempty"`
+	Message map[string]Matcher `json:"message,omitempty"` // JSON に変換したリクエストメッセージのフィールド (ドット区切りでネスト可) ごとのマッチャー
+}
+
+// GRPCResponse describes the status of a gRPC response. The response message is
+// written as JSON in body or bodyFileName; a JSON array streams one message per
+// element from server streaming methods.
+type GRPCResponse struct {
+	Code     any               `json:"code,omitempty"`    // ステータスコード名 (NOT_FOUND) または数値。既定値は OK
+	Message  string            `json:"message,omitempty"` // grpc-message
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Trailers map[string]string `json:"trailers,omitempty"`
+}
+
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+const (
+	grpcInternal        = 13
+	grpcUnimplemented   = 12
+	grpcUnauthenticated = 16
+)
+
+func isGRPC(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// loadDescriptorSets reads compiled FileDescriptorSet files, as produced by
+// `protoc --include_imports --descriptor_set_out`.
+func loadDescriptorSets(names []string) (*protoregistry.Files, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, set); err != nil {
+			return nil, fmt.Errorf("failed to parse descriptor set %s: %w", name, err)
+		}
+		fds.File = append(fds.File, set.File...)
+	}
+	return protodesc.NewFiles(fds)
+}
+
+// grpcCode converts a status code name or number into its numeric value.
+func grpcCode(code any) (int, error) {
+	switch c := code.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(c), nil
+	case int:
+		return c, nil
+	}
+	s := fmt.Sprint(code)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	for i, name := range grpcCodes {
+		if strings.EqualFold(name, s) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gRPC status code %q", s)
+}
+
+// grpcMatcher reports whether the stub matches the method and decoded request message.
+func grpcMatcher(endpoint Endpoint, service, method string, message map[string]any) bool {
+	g := endpoint.Request.GRPC
+	if g == nil || g.Service != service || g.Method != method {
+		return false
+	}
+	for name, m := range g.Message {
+		value, ok := lookupPath(message, name)
+		if !ok {
+			value = ""
+		}
+		if !valueMatcher(m, valueString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveGRPC answers a gRPC call from the stubs with a grpc section.
+func serveGRPC(w http.ResponseWriter, r *http.Request, body []byte, endpoints []Endpoint, files *protoregistry.Files) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if files == nil {
+		writeGRPCStatus(w, grpcUnimplemented, "no descriptor set loaded")
+		return
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("unknown service %s", service))
+		return
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("unknown service %s", service))
+		return
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("unknown method %s/%s", service, method))
+		return
+	}
+
+	frames, err := readGRPCFrames(body)
+	if err != nil {
+		writeGRPCStatus(w, grpcInternal, err.Error())
+		return
+	}
+	// client streams are matched on their first message
+	in := dynamicpb.NewMessage(md.Input())
+	if len(frames) > 0 {
+		if err := proto.Unmarshal(frames[0], in); err != nil {
+			writeGRPCStatus(w, grpcInternal, fmt.Sprintf("failed to decode request message: %s", err))
+			return
+		}
+	}
+	inJSON, err := protojson.Marshal(in)
+	if err != nil {
+		writeGRPCStatus(w, grpcInternal, err.Error())
+		return
+	}
+	message := make(map[string]any)
+	dec := json.NewDecoder(bytes.NewReader(inJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&message); err != nil {
+		writeGRPCStatus(w, grpcInternal, err.Error())
+		return
+	}
+
+	unauthenticated := false
+	for _, endpoint := range endpoints {
+		if !grpcMatcher(endpoint, service, method, message) {
+			continue
+		}
+		if isMatchAuth, challenge := authMatcher(endpoint, r.Header.Get("Authorization")); !isMatchAuth {
+			unauthenticated = unauthenticated || challenge != ""
+			continue
+		}
+		journalStub(r.Context(), endpoint.ID)
+
+		status := GRPCResponse{}
+		if endpoint.Response.GRPC != nil {
+			status = *endpoint.Response.GRPC
+		}
+		code, err := grpcCode(status.Code)
+		if err != nil {
+			writeGRPCStatus(w, grpcInternal, err.Error())
+			return
+		}
+		responseBody, err := renderBody(endpoint.Response, TemplateData{Body: string(inJSON), JSON: message})
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to render response body: %s", err))
+			writeGRPCStatus(w, grpcInternal, "failed to render response body")
+			return
+		}
+		messages, err := encodeGRPCMessages(md, responseBody)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to encode gRPC response: %s", err))
+			writeGRPCStatus(w, grpcInternal, fmt.Sprintf("failed to encode response message: %s", err))
+			return
+		}
+		if code == 0 && len(messages) == 0 && !md.IsStreamingServer() {
+			// unary calls must carry a message; answer with the zero value
+			messages = [][]byte{nil}
+		}
+		if err := sleepContext(r.Context(), responseDelay(endpoint.Response)); err != nil {
+			return
+		}
+
+		for k, v := range status.Metadata {
+			w.Header().Add(k, v)
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		if code != 0 && len(messages) == 0 {
+			// Trailers-Only response
+			w.Header().Set("Grpc-Status", strconv.Itoa(code))
+			if status.Message != "" {
+				w.Header().Set("Grpc-Message", encodeGRPCMessage(status.Message))
+			}
+			for k, v := range status.Trailers {
+				w.Header().Add(k, v)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		for _, m := range messages {
+			if err := writeGRPCFrame(w, m); err != nil {
+				slog.Error(fmt.Sprintf("Failed to write gRPC message: %s", err))
+				return
+			}
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+		if status.Message != "" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(status.Message))
+		}
+		for k, v := range status.Trailers {
+			w.Header().Add(http.TrailerPrefix+k, v)
+		}
+		return
+	}
+	if unauthenticated {
+		writeGRPCStatus(w, grpcUnauthenticated, "missing credentials")
+		return
+	}
+	writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("no stub matched %s/%s", service, method))
+}
+
+// encodeGRPCMessages converts the JSON response body into output messages.
+func encodeGRPCMessages(md protoreflect.MethodDescriptor, body string) ([][]byte, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, nil
+	}
+	docs := []json.RawMessage{json.RawMessage(body)}
+	if md.IsStreamingServer() && strings.HasPrefix(body, "[") {
+		docs = nil
+		if err := json.Unmarshal([]byte(body), &docs); err != nil {
+			return nil, err
+		}
+	}
+	var messages [][]byte
+	for _, doc := range docs {
+		out := dynamicpb.NewMessage(md.Output())
+		if err := protojson.Unmarshal(doc, out); err != nil {
+			return nil, err
+		}
+		b, err := proto.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, b)
+	}
+	return messages, nil
+}
+
+// readGRPCFrames splits a request body into its length-prefixed messages.
+func readGRPCFrames(body []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, errors.New("truncated gRPC frame header")
+		}
+		if body[0] != 0 {
+			return nil, errors.New("compressed gRPC messages are not supported")
+		}
+		n := binary.BigEndian.Uint32(body[1:5])
+		if uint32(len(body)-5) < n {
+			return nil, errors.New("truncated gRPC message")
+		}
+		frames = append(frames, body[5:5+n])
+		body = body[5+n:]
+	}
+	return frames, nil
+}
+
+func writeGRPCFrame(w io.Writer, message []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(message)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(message)
+	return err
+}
+
+// writeGRPCStatus sends a Trailers-Only response carrying just the status.
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes a status message as required for grpc-message.
+func encodeGRPCMessage(message string) string {
+	var sb strings.Builder
+	for _, b := range []byte(message) {
+		if b >= 0x20 && b <= 0x7e && b != '%' {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
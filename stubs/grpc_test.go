@@ -0,0 +1,252 @@
+package stubs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeGreeterDescriptorSet writes the descriptor set of a helloworld.Greeter service.
+func writeGreeterDescriptorSet(t *testing.T) string {
+	t.Helper()
+	stringField := func(name string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+	}
+	fds := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("helloworld.proto"),
+		Package: proto.String("helloworld"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("HelloRequest"), Field: []*descriptorpb.FieldDescriptorProto{stringField("name")}},
+			{Name: proto.String("HelloReply"), Field: []*descriptorpb.FieldDescriptorProto{stringField("message")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("SayHello"), InputType: proto.String(".helloworld.HelloRequest"), OutputType: proto.String(".helloworld.HelloReply")},
+				{Name: proto.String("StreamHellos"), InputType: proto.String(".helloworld.HelloRequest"), OutputType: proto.String(".helloworld.HelloReply"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}}}
+	b, err := proto.Marshal(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "helloworld.pb")
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func grpcFrame(t *testing.T, files *protoregistry.Files, messageName, jsonMessage string) []byte {
+	t.Helper()
+	d, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+	if err := protojson.Unmarshal([]byte(jsonMessage), m); err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5, 5+len(b))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+	return append(frame, b...)
+}
+
+func grpcReplies(t *testing.T, files *protoregistry.Files, body []byte) []string {
+	t.Helper()
+	d, err := files.FindDescriptorByName("helloworld.HelloReply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies []string
+	for len(body) >= 5 {
+		n := binary.BigEndian.Uint32(body[1:5])
+		m := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+		if err := proto.Unmarshal(body[5:5+n], m); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, m.Get(m.Descriptor().Fields().ByName("message")).String())
+		body = body[5+n:]
+	}
+	return replies
+}
+
+func Test_serveGRPC(t *testing.T) {
+	files, err := loadDescriptorSets([]string{writeGreeterDescriptorSet(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := []Endpoint{
+		{
+			Request: Request{GRPC: &GRPCRequest{
+				Service: "helloworld.Greeter",
+				Method:  "SayHello",
+				Message: map[string]Matcher{"name": {EqualTo: "error"}},
+			}},
+			Response: Response{GRPC: &GRPCResponse{Code: "NOT_FOUND", Message: "no such user"}},
+		},
+		{
+			Request: Request{GRPC: &GRPCRequest{
+				Service: "helloworld.Greeter",
+				Method:  "SayHello",
+				Message: map[string]Matcher{"name": {Matches: "^[a-z]+$"}},
+			}},
+			Response: Response{
+				Body: `{"message": "hello"}`,
+				GRPC: &GRPCResponse{Metadata: map[string]string{"x-stub": "1"}, Trailers: map[string]string{"x-trace": "abc"}},
+			},
+		},
+		{
+			Request:  Request{GRPC: &GRPCRequest{Service: "helloworld.Greeter", Method: "StreamHellos"}},
+			Response: Response{Body: `[{"message": "one"}, {"message": "two"}]`},
+		},
+	}
+	tests := []struct {
+		name         string
+		path         string
+		request      string
+		wantStatus   string
+		wantMessage  string
+		wantReplies  []string
+		wantHeader   map[string]string
+		wantTrailers map[string]string
+	}{
+		{
+			name:         "unary",
+			path:         "/helloworld.Greeter/SayHello",
+			request:      `{"name": "world"}`,
+			wantStatus:   "0",
+			wantReplies:  []string{"hello"},
+			wantHeader:   map[string]string{"X-Stub": "1"},
+			wantTrailers: map[string]string{"X-Trace": "abc"},
+		},
+		{
+			name:        "error status",
+			path:        "/helloworld.Greeter/SayHello",
+			request:     `{"name": "error"}`,
+			wantStatus:  "5",
+			wantMessage: "no such user",
+		},
+		{
+			name:       "server streaming",
+			path:       "/helloworld.Greeter/StreamHellos",
+			request:    `{"name": "world"}`,
+			wantStatus: "0",
+			wantReplies: []string{
+				"one", "two",
+			},
+		},
+		{
+			name:        "no stub matched",
+			path:        "/helloworld.Greeter/SayHello",
+			request:     `{"name": "World 1"}`,
+			wantStatus:  "12",
+			wantMessage: "no stub matched helloworld.Greeter/SayHello",
+		},
+		{
+			name:       "unknown method",
+			path:       "/helloworld.Greeter/SayGoodbye",
+			request:    `{}`,
+			wantStatus: "12",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := grpcFrame(t, files, "helloworld.HelloRequest", tt.request)
+			r := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/grpc")
+			w := httptest.NewRecorder()
+			serveGRPC(w, r, body, endpoints, files)
+
+			res := w.Result()
+			got, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := res.Trailer.Get("Grpc-Status")
+			message := res.Trailer.Get("Grpc-Message")
+			if status == "" {
+				status = res.Header.Get("Grpc-Status")
+				message = res.Header.Get("Grpc-Message")
+			}
+			if status != tt.wantStatus {
+				t.Errorf("grpc-status = %q, want %q", status, tt.wantStatus)
+			}
+			if tt.wantMessage != "" && message != tt.wantMessage {
+				t.Errorf("grpc-message = %q, want %q", message, tt.wantMessage)
+			}
+			if replies := grpcReplies(t, files, got); !cmp.Equal(replies, tt.wantReplies) {
+				t.Errorf("diff: %v", cmp.Diff(replies, tt.wantReplies))
+			}
+			for k, v := range tt.wantHeader {
+				if res.Header.Get(k) != v {
+					t.Errorf("header %s = %q, want %q", k, res.Header.Get(k), v)
+				}
+			}
+			for k, v := range tt.wantTrailers {
+				if res.Trailer.Get(k) != v {
+					t.Errorf("trailer %s = %q, want %q", k, res.Trailer.Get(k), v)
+				}
+			}
+		})
+	}
+}
+
+func Test_serveGRPCDelay(t *testing.T) {
+	files, err := loadDescriptorSets([]string{writeGreeterDescriptorSet(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := []Endpoint{{
+		Request:  Request{GRPC: &GRPCRequest{Service: "helloworld.Greeter", Method: "SayHello"}},
+		Response: Response{Body: `{"message": "hello"}`, FixedDelayMilliseconds: 100},
+	}}
+	body := grpcFrame(t, files, "helloworld.HelloRequest", `{"name": "world"}`)
+
+	r := httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	start := time.Now()
+	serveGRPC(w, r, body, endpoints, files)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("answered after %v, want at least 100ms", elapsed)
+	}
+	if replies := grpcReplies(t, files, w.Body.Bytes()); !cmp.Equal(replies, []string{"hello"}) {
+		t.Errorf("replies = %v, want [hello]", replies)
+	}
+
+	// a client that gives up during the delay gets nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	serveGRPC(w, r.WithContext(ctx), body, endpoints, files)
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Errorf("cancelled call wrote %q with headers %v", w.Body.String(), w.Header())
+	}
+}
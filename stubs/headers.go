@@ -0,0 +1,73 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// HeaderValues holds the values of a response header. It is written as a string,
+// or as an array for multi-valued headers such as Set-Cookie.
+type HeaderValues []string
+
+func (h *HeaderValues) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err == nil {
+		*h = HeaderValues{value}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("header value must be a string or an array of strings: %w", err)
+	}
+	*h = values
+	return nil
+}
+
+func (h HeaderValues) MarshalJSON() ([]byte, error) {
+	if len(h) == 1 {
+		return json.Marshal(h[0])
+	}
+	return json.Marshal([]string(h))
+}
+
+// applyHeaders renders the configured headers with the template data and sets
+// them, replacing any value set before.
+func applyHeaders(header http.Header, headers map[string]HeaderValues, gp TemplateData) error {
+	for name, values := range headers {
+		header.Del(name)
+		for _, value := range values {
+			rendered, err := renderTemplate(value, gp)
+			if err != nil {
+				return fmt.Errorf("header %s: %w", name, err)
+			}
+			header.Add(name, rendered)
+		}
+	}
+	return nil
+}
+
+// defaultContentType infers the Content-Type from the extension of bodyFileName,
+// or else from the transformed body.
+func defaultContentType(response Response, body string) string {
+	if response.BodyFileName != "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(response.BodyFileName)); contentType != "" {
+			return contentType
+		}
+	}
+	trimmed := strings.TrimSpace(body)
+	switch {
+	case trimmed == "":
+		return ""
+	case json.Valid([]byte(trimmed)):
+		return "application/json"
+	}
+	contentType := http.DetectContentType([]byte(trimmed))
+	if strings.HasPrefix(contentType, "text/plain") && strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") {
+		return "application/xml"
+	}
+	return contentType
+}
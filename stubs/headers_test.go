@@ -0,0 +1,83 @@
+package stubs
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_HeaderValues(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want HeaderValues
+	}{
+		{name: "string", json: `"text/plain"`, want: HeaderValues{"text/plain"}},
+		{name: "array", json: `["a=1", "b=2"]`, want: HeaderValues{"a=1", "b=2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got HeaderValues
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("HeaderValues mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	var invalid HeaderValues
+	if err := json.Unmarshal([]byte(`1`), &invalid); err == nil {
+		t.Error("expected an error for a number")
+	}
+}
+
+func Test_applyHeaders(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	headers := map[string]HeaderValues{
+		"Content-Type": {"application/vnd.api+json"},
+		"Location":     {"/users/{{.Path.id}}"},
+		"Set-Cookie":   {"a=1", "b={{.Query.b}}"},
+	}
+	gp := TemplateData{Path: map[string]string{"id": "42"}, Query: map[string]string{"b": "2"}}
+	if err := applyHeaders(header, headers, gp); err != nil {
+		t.Fatal(err)
+	}
+	want := http.Header{
+		"Content-Type": {"application/vnd.api+json"},
+		"Location":     {"/users/42"},
+		"Set-Cookie":   {"a=1", "b=2"},
+	}
+	if diff := cmp.Diff(want, header); diff != "" {
+		t.Errorf("applyHeaders() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := applyHeaders(http.Header{}, map[string]HeaderValues{"X": {"{{"}}, gp); err == nil {
+		t.Error("expected an error for a broken template")
+	}
+}
+
+func Test_defaultContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		response Response
+		body     string
+		want     string
+	}{
+		{name: "empty", body: "", want: ""},
+		{name: "json", body: `{"a": 1}`, want: "application/json"},
+		{name: "xml", body: `<user><id>1</id></user>`, want: "application/xml"},
+		{name: "html", body: `<!DOCTYPE html><html></html>`, want: "text/html; charset=utf-8"},
+		{name: "text", body: "hello", want: "text/plain; charset=utf-8"},
+		{name: "file extension", response: Response{BodyFileName: "users.csv"}, body: "id\n1", want: "text/csv; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultContentType(tt.response, tt.body); got != tt.want {
+				t.Errorf("defaultContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package stubs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const unmatchedStub = "unmatched"
+
+// JournalEntry is a received request as written to the journal.
+type JournalEntry struct {
+	ID                  int64       `json:"id"`
+	Timestamp           time.Time   `json:"timestamp"`
+	Method              string      `json:"method"`
+	URL                 string      `json:"url"` // パスとクエリ
+	Headers             http.Header `json:"headers"`
+	Body                string      `json:"body"`
+	BodyEncoding        string      `json:"bodyEncoding,omitempty"`  // UTF-8 でないボディは base64
+	BodyTruncated       bool        `json:"bodyTruncated,omitempty"` // ボディが上限で切り詰められた
+	StubID              string      `json:"stubId"`                  // 応答したスタブの id。複数の場合はカンマ区切り。一致しなかった場合は unmatched
+	Status              int         `json:"status"`                  // 接続を乗っ取った、または中断した場合は 0
+	LatencyMilliseconds float64     `json:"latencyMilliseconds"`
+}
+
+// journal keeps the latest requests in memory and appends every request to sink.
+type journal struct {
+	mu        sync.Mutex
+	entries   []JournalEntry // リングバッファ
+	start     int            // 最も古いエントリの位置
+	capacity  int
+	seq       int64
+	bodyLimit int
+	sink      io.Writer // nil の場合はファイルに書き出さない
+}
+
+func newJournal(capacity, bodyLimit int, sink io.Writer) *journal {
+	return &journal{capacity: capacity, bodyLimit: bodyLimit, sink: sink}
+}
+
+func (j *journal) add(e JournalEntry) JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq++
+	e.ID = j.seq
+	if j.sink != nil {
+		line, err := json.Marshal(e)
+		if err == nil {
+			_, err = j.sink.Write(append(line, '\n'))
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to write request journal: %s", err))
+		}
+	}
+	switch {
+	case j.capacity <= 0:
+	case len(j.entries) < j.capacity:
+		j.entries = append(j.entries, e)
+	default:
+		j.entries[j.start] = e
+		j.start = (j.start + 1) % j.capacity
+	}
+	return e
+}
+
+// list returns the entries in memory, oldest first.
+func (j *journal) list() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append(slices.Clone(j.entries[j.start:]), j.entries[:j.start]...)
+}
+
+// clear empties the memory; the file is kept.
+func (j *journal) clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = nil
+	j.start = 0
+}
+
+// entry builds the journal entry of a request, capping the body unless the
+// limit is negative.
+func (j *journal) entry(r *http.Request, body []byte) JournalEntry {
+	e := JournalEntry{
+		Method:  r.Method,
+		URL:     r.URL.RequestURI(),
+		Headers: r.Header.Clone(),
+	}
+	if j.bodyLimit >= 0 && len(body) > j.bodyLimit {
+		cut := j.bodyLimit
+		// don't split a UTF-8 sequence
+		for cut > 0 && cut > j.bodyLimit-utf8.UTFMax && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		body = body[:cut]
+		e.BodyTruncated = true
+	}
+	if utf8.Valid(body) {
+		e.Body = string(body)
+	} else {
+		e.Body = base64.StdEncoding.EncodeToString(body)
+		e.BodyEncoding = "base64"
+	}
+	return e
+}
+
+type journalKey struct{}
+
+// journalMatch collects the stubs that answered a request.
+type journalMatch struct {
+	ids []string
+}
+
+// journalStub notes in the journal that the stub answered the request.
+func journalStub(ctx context.Context, id string) {
+	if m, ok := ctx.Value(journalKey{}).(*journalMatch); ok && !slices.Contains(m.ids, id) {
+		m.ids = append(m.ids, id)
+	}
+}
+
+// middleware journals the requests served by next.
+func (j *journal) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to read request body: %s", err))
+			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		match := &journalMatch{}
+		r = r.WithContext(context.WithValue(r.Context(), journalKey{}, match))
+		jw := &journalWriter{ResponseWriter: w}
+
+		completed := false
+		// also journal requests that are aborted with a panic
+		defer func() {
+			e := j.entry(r, body)
+			e.Timestamp = start
+			e.LatencyMilliseconds = float64(time.Since(start).Microseconds()) / 1000
+			e.StubID = unmatchedStub
+			if len(match.ids) > 0 {
+				e.StubID = strings.Join(match.ids, ",")
+			}
+			e.Status = jw.status
+			if e.Status == 0 && completed && !jw.hijacked {
+				e.Status = http.StatusOK
+			}
+			j.add(e)
+		}()
+		next.ServeHTTP(jw, r)
+		completed = true
+	})
+}
+
+// journalWriter remembers the status written to the response.
+type journalWriter struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+}
+
+func (w *journalWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *journalWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *journalWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
+}
+
+func (w *journalWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (j *journal) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /__admin/requests", j.handleList)
+	mux.HandleFunc("GET /__admin/requests/{id}", j.handleGet)
+	mux.HandleFunc("DELETE /__admin/requests", j.handleClear)
+	mux.HandleFunc("POST /__admin/requests/verify", j.handleVerify)
+}
+
+// handleList answers GET /__admin/requests with the journaled requests, newest
+// first, filtered by the method, url (substring), stubId, status and since
+// (RFC 3339) query parameters and capped by limit.
+func (j *journal) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := -1
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries := j.list()
+	slices.Reverse(entries)
+	requests := []JournalEntry{}
+	total := 0
+	for _, e := range entries {
+		if (q.Has("method") && !strings.EqualFold(e.Method, q.Get("method"))) ||
+			(q.Has("url") && !strings.Contains(e.URL, q.Get("url"))) ||
+			(q.Has("stubId") && !slices.Contains(strings.Split(e.StubID, ","), q.Get("stubId"))) ||
+			(q.Has("status") && strconv.Itoa(e.Status) != q.Get("status")) ||
+			e.Timestamp.Before(since) {
+			continue
+		}
+		total++
+		if limit < 0 || len(requests) < limit {
+			requests = append(requests, e)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"requests": requests, "total": total}); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write requests: %s", err))
+	}
+}
+
+func (j *journal) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, e := range j.list() {
+		if e.ID == id {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(e); err != nil {
+				slog.Error(fmt.Sprintf("Failed to write request: %s", err))
+			}
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (j *journal) handleClear(w http.ResponseWriter, r *http.Request) {
+	j.clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotatingFile appends to a file, renaming it to path.1, path.2, ... once it
+// grows past maxSize and keeping maxFiles of the old files.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64 // 0 の場合はローテーションしない
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxFiles <= 0 {
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		return f.open()
+	}
+	for i := f.maxFiles; i >= 1; i-- {
+		src := f.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", f.path, i-1)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", f.path, i)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,200 @@
+package stubs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_journalMiddleware(t *testing.T) {
+	var sink bytes.Buffer
+	j := newJournal(10, 8, &sink)
+	handler := j.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/users":
+			journalStub(r.Context(), "users.json#0")
+			w.WriteHeader(http.StatusCreated)
+		case "/silent":
+			journalStub(r.Context(), "silent.json#0")
+		case "/echo":
+			w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/users?x=1", strings.NewReader(`{"name":"a"}`)),
+		httptest.NewRequest(http.MethodGet, "/silent", nil),
+		httptest.NewRequest(http.MethodPut, "/echo", strings.NewReader("héllo wörld")),
+		httptest.NewRequest(http.MethodGet, "/missing", bytes.NewReader([]byte{0xff, 0xfe})),
+	}
+	requests[0].Header.Set("X-Trace", "t1")
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/echo", strings.NewReader("full body")))
+	if body := rec.Body.String(); body != "full body" {
+		t.Errorf("handler read %q, want the whole body", body)
+	}
+
+	ignore := cmpopts.IgnoreFields(JournalEntry{}, "Timestamp", "LatencyMilliseconds")
+	want := []JournalEntry{
+		{ID: 1, Method: "POST", URL: "/users?x=1", Headers: http.Header{"X-Trace": {"t1"}}, Body: `{"name":`, BodyTruncated: true, StubID: "users.json#0", Status: 201},
+		{ID: 2, Method: "GET", URL: "/silent", Headers: http.Header{}, Body: "", StubID: "silent.json#0", Status: 200},
+		{ID: 3, Method: "PUT", URL: "/echo", Headers: http.Header{}, Body: "héllo w", BodyTruncated: true, StubID: "unmatched", Status: 200},
+		{ID: 4, Method: "GET", URL: "/missing", Headers: http.Header{}, Body: "//4=", BodyEncoding: "base64", StubID: "unmatched", Status: 404},
+		{ID: 5, Method: "PUT", URL: "/echo", Headers: http.Header{}, Body: "full bod", BodyTruncated: true, StubID: "unmatched", Status: 200},
+	}
+
+	var written []JournalEntry
+	dec := json.NewDecoder(&sink)
+	for dec.More() {
+		var e JournalEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Timestamp.IsZero() {
+			t.Errorf("entry %d has no timestamp", e.ID)
+		}
+		written = append(written, e)
+	}
+	if diff := cmp.Diff(want, written, ignore); diff != "" {
+		t.Errorf("journal file mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_journalBodyLimit(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	tests := []struct {
+		name          string
+		limit         int
+		wantBody      string
+		wantTruncated bool
+	}{
+		{name: "default", limit: 0, wantBody: body},
+		{name: "capped", limit: 10, wantBody: body[:10], wantTruncated: true},
+		{name: "no limit", limit: -1, wantBody: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(Options{JournalBodyLimit: tt.limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body)))
+			requests := server.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("journaled %d requests, want 1", len(requests))
+			}
+			if got := requests[0]; got.Body != tt.wantBody || got.BodyTruncated != tt.wantTruncated {
+				t.Errorf("entry body = %q truncated %v, want %q truncated %v", got.Body, got.BodyTruncated, tt.wantBody, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func Test_journalRingBuffer(t *testing.T) {
+	j := newJournal(3, 100, nil)
+	handler := j.middleware(http.NotFoundHandler())
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	mux := muxOf(j.register)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+		total  int
+	}{
+		{name: "newest first", target: "/__admin/requests", want: []string{"/e", "/d", "/c"}, total: 3},
+		{name: "limit", target: "/__admin/requests?limit=1", want: []string{"/e"}, total: 3},
+		{name: "url", target: "/__admin/requests?url=d", want: []string{"/d"}, total: 1},
+		{name: "no match", target: "/__admin/requests?method=POST", want: []string{}, total: 0},
+		{name: "stub", target: "/__admin/requests?stubId=unmatched&status=404", want: []string{"/e", "/d", "/c"}, total: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			var got struct {
+				Requests []JournalEntry `json:"requests"`
+				Total    int            `json:"total"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			urls := []string{}
+			for _, e := range got.Requests {
+				urls = append(urls, e.URL)
+			}
+			if diff := cmp.Diff(tt.want, urls); diff != "" || got.Total != tt.total {
+				t.Errorf("total = %d, want %d; urls mismatch (-want +got):\n%s", got.Total, tt.total, diff)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__admin/requests/4", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"url":"/d"`) {
+		t.Errorf("GET /__admin/requests/4 = %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__admin/requests/1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET of an entry dropped from memory = %d, want 404", rec.Code)
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/__admin/requests", nil))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__admin/requests", nil))
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"requests":[],"total":0}` {
+		t.Errorf("after clearing = %s", body)
+	}
+}
+
+func Test_rotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), b, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 rotated files are kept")
+	}
+}
@@ -0,0 +1,226 @@
+package stubs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// JSONRPCRequest matches a JSON-RPC 2.0 call. Batches are answered element by element.
+type JSONRPCRequest struct {
+	Method string             `json:"method,omitempty"`
+	Params map[string]Matcher `json:"params,omitempty"` // パラメータ名 (ドット区切りでネスト可)、または位置パラメータの添字 ("0") ごとのマッチャー
+}
+
+// JSONRPCResponse answers with an error object instead of the body as result.
+type JSONRPCResponse struct {
+	Error *JSONRPCError `json:"error,omitempty"`
+}
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInternalError  = -32603
+)
+
+type jsonrpcCall struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  *string         `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcReply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcMatcher reports whether the stub answers the method with the given params.
+func jsonrpcMatcher(endpoint Endpoint, method string, params map[string]any) bool {
+	j := endpoint.Request.JSONRPC
+	if j == nil || j.Method != method {
+		return false
+	}
+	for name, m := range j.Params {
+		value, ok := lookupPath(params, name)
+		if !ok {
+			value = ""
+		}
+		if !valueMatcher(m, valueString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveJSONRPC answers a single or batch JSON-RPC request from the JSON-RPC stubs
+// sharing the request's URL and method.
+func serveJSONRPC(w http.ResponseWriter, r *http.Request, body []byte, endpoints []Endpoint) {
+	var candidates []Endpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Request.JSONRPC == nil || endpoint.Request.Method != r.Method {
+			continue
+		}
+		if isMatchPath, _ := pathMatcher(endpoint, r.URL.RawPath, r.URL.Path); !isMatchPath {
+			continue
+		}
+		if isMatchAuth, _ := authMatcher(endpoint, r.Header.Get("Authorization")); !isMatchAuth {
+			continue
+		}
+		candidates = append(candidates, endpoint)
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var calls []json.RawMessage
+		if err := json.Unmarshal(trimmed, &calls); err != nil {
+			writeJSONRPC(w, jsonrpcErrorReply(nil, jsonrpcParseError, "Parse error"))
+			return
+		}
+		if len(calls) == 0 {
+			writeJSONRPC(w, jsonrpcErrorReply(nil, jsonrpcInvalidRequest, "Invalid Request"))
+			return
+		}
+		var replies []jsonrpcReply
+		// the calls of a batch are answered together, after the longest delay
+		var delay time.Duration
+		for _, call := range calls {
+			reply, d, ok := answerJSONRPC(r.Context(), call, candidates)
+			delay = max(delay, d)
+			if ok {
+				replies = append(replies, reply)
+			}
+		}
+		if err := sleepContext(r.Context(), delay); err != nil {
+			return
+		}
+		if len(replies) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSONRPC(w, replies)
+		return
+	}
+	if !json.Valid(trimmed) {
+		writeJSONRPC(w, jsonrpcErrorReply(nil, jsonrpcParseError, "Parse error"))
+		return
+	}
+	reply, delay, ok := answerJSONRPC(r.Context(), trimmed, candidates)
+	if err := sleepContext(r.Context(), delay); err != nil {
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONRPC(w, reply)
+}
+
+// answerJSONRPC answers one call, along with the delay of the matched stub.
+// Notifications get no reply.
+func answerJSONRPC(ctx context.Context, raw json.RawMessage, candidates []Endpoint) (jsonrpcReply, time.Duration, bool) {
+	var call jsonrpcCall
+	if err := json.Unmarshal(raw, &call); err != nil || call.JSONRPC != "2.0" || call.Method == nil || !validJSONRPCID(call.ID) {
+		return jsonrpcErrorReply(nil, jsonrpcInvalidRequest, "Invalid Request"), 0, true
+	}
+	params, ok := decodeJSONRPCParams(call.Params)
+	if !ok {
+		return jsonrpcErrorReply(call.ID, jsonrpcInvalidRequest, "Invalid Request"), 0, true
+	}
+	isNotification := call.ID == nil
+
+	for _, endpoint := range candidates {
+		if !jsonrpcMatcher(endpoint, *call.Method, params) {
+			continue
+		}
+		journalStub(ctx, endpoint.ID)
+		delay := responseDelay(endpoint.Response)
+		if isNotification {
+			return jsonrpcReply{}, delay, false
+		}
+		if endpoint.Response.JSONRPC != nil && endpoint.Response.JSONRPC.Error != nil {
+			return jsonrpcReply{JSONRPC: "2.0", Error: endpoint.Response.JSONRPC.Error, ID: call.ID}, delay, true
+		}
+		result, err := renderBody(endpoint.Response, TemplateData{Body: string(raw), JSON: parseJSONBody(raw)})
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to render response body: %s", err))
+			return jsonrpcErrorReply(call.ID, jsonrpcInternalError, "Internal error"), delay, true
+		}
+		if len(bytes.TrimSpace([]byte(result))) == 0 {
+			result = "null"
+		}
+		if !json.Valid([]byte(result)) {
+			slog.Error(fmt.Sprintf("JSON-RPC result of %s is not valid JSON", *call.Method))
+			return jsonrpcErrorReply(call.ID, jsonrpcInternalError, "Internal error"), delay, true
+		}
+		return jsonrpcReply{JSONRPC: "2.0", Result: json.RawMessage(result), ID: call.ID}, delay, true
+	}
+	if isNotification {
+		return jsonrpcReply{}, 0, false
+	}
+	return jsonrpcErrorReply(call.ID, jsonrpcMethodNotFound, "Method not found"), 0, true
+}
+
+func validJSONRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch bytes.TrimSpace(id)[0] {
+	case '{', '[', 't', 'f':
+		return false
+	}
+	return true
+}
+
+// decodeJSONRPCParams returns by-name params as is and by-position params keyed by index.
+func decodeJSONRPCParams(raw json.RawMessage) (map[string]any, bool) {
+	params := make(map[string]any)
+	if len(raw) == 0 {
+		return params, true
+	}
+	var v any
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, false
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		return v, true
+	case []any:
+		for i, p := range v {
+			params[strconv.Itoa(i)] = p
+		}
+		return params, true
+	default:
+		return nil, false
+	}
+}
+
+func jsonrpcErrorReply(id json.RawMessage, code int, message string) jsonrpcReply {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return jsonrpcReply{JSONRPC: "2.0", Error: &JSONRPCError{Code: code, Message: message}, ID: id}
+}
+
+func writeJSONRPC(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write JSON-RPC response: %s", err))
+	}
+}
@@ -0,0 +1,136 @@
+package stubs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_serveJSONRPC(t *testing.T) {
+	endpoints := []Endpoint{
+		{
+			Request: Request{
+				URLPath: "/rpc",
+				Method:  "POST",
+				JSONRPC: &JSONRPCRequest{
+					Method: "eth_getBalance",
+					Params: map[string]Matcher{"0": {Matches: "^0x[0-9a-f]+$"}},
+				},
+			},
+			Response: Response{Body: `"0x1"`},
+		},
+		{
+			Request: Request{
+				URLPath: "/rpc",
+				Method:  "POST",
+				JSONRPC: &JSONRPCRequest{
+					Method: "user.get",
+					Params: map[string]Matcher{"id": {EqualTo: 404}},
+				},
+			},
+			Response: Response{JSONRPC: &JSONRPCResponse{Error: &JSONRPCError{Code: -32004, Message: "User not found", Data: "404"}}},
+		},
+		{
+			Request: Request{
+				URLPath: "/rpc",
+				Method:  "POST",
+				JSONRPC: &JSONRPCRequest{Method: "user.get"},
+			},
+			Response: Response{Body: `{"name": "alice"}`},
+		},
+		{
+			Request: Request{
+				URLPath: "/other",
+				Method:  "POST",
+				JSONRPC: &JSONRPCRequest{Method: "ping"},
+			},
+			Response: Response{Body: `"pong"`},
+		},
+	}
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "positional params",
+			body:       `{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0xabc", "latest"], "id": 1}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","result":"0x1","id":1}`,
+		},
+		{
+			name:       "named params and string id",
+			body:       `{"jsonrpc": "2.0", "method": "user.get", "params": {"id": 1}, "id": "req-1"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","result":{"name":"alice"},"id":"req-1"}`,
+		},
+		{
+			name:       "error stub",
+			body:       `{"jsonrpc": "2.0", "method": "user.get", "params": {"id": 404}, "id": 2}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","error":{"code":-32004,"message":"User not found","data":"404"},"id":2}`,
+		},
+		{
+			name:       "method not found",
+			body:       `{"jsonrpc": "2.0", "method": "ping", "id": 3}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":3}`,
+		},
+		{
+			name:       "notification",
+			body:       `{"jsonrpc": "2.0", "method": "user.get", "params": {"id": 1}}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "parse error",
+			body:       `{"jsonrpc": "2.0", "method"`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name:       "invalid request",
+			body:       `{"jsonrpc": "1.0", "method": "user.get", "id": 4}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name:       "empty batch",
+			body:       `[]`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name: "batch",
+			body: `[
+				{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0xabc"], "id": 1},
+				{"jsonrpc": "2.0", "method": "user.get", "params": {"id": 1}},
+				{"jsonrpc": "2.0", "method": "user.get", "params": {"id": 404}, "id": 2},
+				1
+			]`,
+			wantStatus: http.StatusOK,
+			wantBody: `[{"jsonrpc":"2.0","result":"0x1","id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32004,"message":"User not found","data":"404"},"id":2},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`,
+		},
+		{
+			name:       "batch of notifications",
+			body:       `[{"jsonrpc": "2.0", "method": "user.get"}]`,
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			serveJSONRPC(w, r, []byte(tt.body), endpoints)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,16 +1,16 @@
-package main_test
+package stubs
 
 import (
+	"net/http"
 	"net/url"
 	"testing"
 
-	main "github.com/dev-shimada/api-stubs"
 	"github.com/google/go-cmp/cmp"
 )
 
 func Test_pathMatcher(t *testing.T) {
 	type args struct {
-		endpoint   main.Endpoint
+		endpoint   Endpoint
 		gotRawPath string
 		gotPath    string
 	}
@@ -23,8 +23,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "url",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URL: "http://example.com/path",
 					},
 				},
@@ -35,8 +35,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "url false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URL: "http://example.com/path",
 					},
 				},
@@ -47,8 +47,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPattern",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPattern: "http://example.com/(\\d{5})/",
 					},
 				},
@@ -59,8 +59,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPattern false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPattern: "http://example.com/(\\d{5})/",
 					},
 				},
@@ -71,8 +71,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPath",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPath: "http://example.com/path",
 					},
 				},
@@ -83,8 +83,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPath false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPath: "http://example.com/path",
 					},
 				},
@@ -95,8 +95,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathPattern",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathPattern: "http://example.com/(\\d{5})",
 					},
 				},
@@ -107,8 +107,8 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathPattern false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathPattern: "http://example.com/(\\d{5})",
 					},
 				},
@@ -119,10 +119,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path1}/{path2}/{path3}/{path4}/{path5}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path1": {
 								EqualTo: "12345",
 							},
@@ -155,10 +155,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate equalTo false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path": {
 								EqualTo: "12345",
 							},
@@ -172,10 +172,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate contains false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path": {
 								Contains: "12345",
 							},
@@ -189,10 +189,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate doesNotContain false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path": {
 								DoesNotContain: "12345",
 							},
@@ -206,10 +206,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate matches false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path": {
 								Matches: "[0-9]{5}",
 							},
@@ -223,10 +223,10 @@ func Test_pathMatcher(t *testing.T) {
 		{
 			name: "urlPathTemplate doesNotMatch false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
+				endpoint: Endpoint{
+					Request: Request{
 						URLPathTemplate: "http://example.com/{path}",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path": {
 								DoesNotMatch: "[0-9]{5}",
 							},
@@ -240,7 +240,7 @@ func Test_pathMatcher(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got, gotMap := main.ExportPathMatcher(tt.args.endpoint, tt.args.gotRawPath, tt.args.gotPath); got != tt.want {
+			if got, gotMap := pathMatcher(tt.args.endpoint, tt.args.gotRawPath, tt.args.gotPath); got != tt.want {
 				t.Errorf("pathMatcher() = %v, want %v", got, tt.want)
 			} else if !cmp.Equal(gotMap, tt.wantMap) {
 				t.Errorf("diff: %v", cmp.Diff(gotMap, tt.wantMap))
@@ -251,7 +251,7 @@ func Test_pathMatcher(t *testing.T) {
 
 func Test_queryMatcher(t *testing.T) {
 	type args struct {
-		endpoint main.Endpoint
+		endpoint Endpoint
 		gotQuery url.Values
 	}
 	tests := []struct {
@@ -262,9 +262,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "all",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param1": {
 								EqualTo: "12345",
 							},
@@ -296,9 +296,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "equalTo false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param": {
 								EqualTo: "12345",
 							},
@@ -314,9 +314,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "contains false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param": {
 								Contains: "12345",
 							},
@@ -332,9 +332,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "doesNotContain false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param": {
 								DoesNotContain: "12345",
 							},
@@ -350,9 +350,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "matches false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param": {
 								Matches: "[0-9]{5}",
 							},
@@ -368,9 +368,9 @@ func Test_queryMatcher(t *testing.T) {
 		{
 			name: "doesNotMatch false",
 			args: args{
-				endpoint: main.Endpoint{
-					Request: main.Request{
-						QueryParameters: map[string]main.Matcher{
+				endpoint: Endpoint{
+					Request: Request{
+						QueryParameters: map[string]Matcher{
 							"param": {
 								DoesNotMatch: "[0-9]{5}",
 							},
@@ -386,7 +386,7 @@ func Test_queryMatcher(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := main.ExportQueryMatcher(tt.args.endpoint, tt.args.gotQuery); got != tt.want {
+			if got := queryMatcher(tt.args.endpoint, tt.args.gotQuery); got != tt.want {
 				t.Errorf("queryMatcher() = %v, want %v", got, tt.want)
 			}
 		})
@@ -400,7 +400,7 @@ func Test_loadConfig(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    []main.Endpoint
+		want    []Endpoint
 		wantErr bool
 	}{
 		{
@@ -408,12 +408,13 @@ func Test_loadConfig(t *testing.T) {
 			args: args{
 				filePath: "testdata/test_config.json",
 			},
-			want: []main.Endpoint{
+			want: []Endpoint{
 				{
-					Request: main.Request{
+					ID: "testdata/test_config.json#0",
+					Request: Request{
 						URLPathTemplate: "/example/{path1}/{path2}/{path3}/{path4}/{path5}",
 						Method:          "GET",
-						PathParameters: map[string]main.Matcher{
+						PathParameters: map[string]Matcher{
 							"path1": {
 								EqualTo: "v1",
 							},
@@ -430,7 +431,7 @@ func Test_loadConfig(t *testing.T) {
 								DoesNotContain: "b",
 							},
 						},
-						QueryParameters: map[string]main.Matcher{
+						QueryParameters: map[string]Matcher{
 							"param1": {
 								EqualTo: "value1",
 							},
@@ -448,7 +449,7 @@ func Test_loadConfig(t *testing.T) {
 							},
 						},
 					},
-					Response: main.Response{
+					Response: Response{
 						Status: 200,
 						Body:   `{"message": "This is a stub response", "param1"="{{.Query.param1}}", "param2"="{{.Query.param2}}", "param3"="{{.Query.param3}}", "param4"="{{.Query.param4}}", "param5"="{{.Query.param5}}"}` + "\n",
 					},
@@ -459,7 +460,7 @@ func Test_loadConfig(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := main.ExportLoadConfig(tt.args.filePath)
+			got, err := loadConfig(tt.args.filePath)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -470,3 +471,10 @@ func Test_loadConfig(t *testing.T) {
 		})
 	}
 }
+
+// muxOf returns a mux with the routes added by register.
+func muxOf(register func(*http.ServeMux)) *http.ServeMux {
+	mux := http.NewServeMux()
+	register(mux)
+	return mux
+}
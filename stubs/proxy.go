@@ -0,0 +1,183 @@
+package stubs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyOptions tune how a request is forwarded to the upstream.
+type ProxyOptions struct {
+	AddRequestHeaders     map[string]string `json:"addRequestHeaders,omitempty"`
+	RemoveRequestHeaders  []string          `json:"removeRequestHeaders,omitempty"`
+	AddResponseHeaders    map[string]string `json:"addResponseHeaders,omitempty"`
+	RemoveResponseHeaders []string          `json:"removeResponseHeaders,omitempty"`
+	TimeoutMilliseconds   int               `json:"timeoutMilliseconds,omitempty"` // 既定値は 30000
+	InsecureSkipVerify    bool              `json:"insecureSkipVerify,omitempty"`  // upstream の証明書を検証しない
+	CAFile                string            `json:"caFile,omitempty"`              // upstream の証明書を検証する CA (PEM)
+}
+
+// Hop-by-hop headers apply to a single connection and are not forwarded.
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Proxy-Connection",
+}
+
+// proxyClients shares a client, and so its connections, per TLS setting.
+var proxyClients sync.Map
+
+func proxyClient(opts ProxyOptions) (*http.Client, error) {
+	key := fmt.Sprintf("%t|%s", opts.InsecureSkipVerify, opts.CAFile)
+	if c, ok := proxyClients.Load(key); ok {
+		return c.(*http.Client), nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	// upstream responses, redirects included, are relayed as they are
+	client := &http.Client{
+		Transport:     transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	c, _ := proxyClients.LoadOrStore(key, client)
+	return c.(*http.Client), nil
+}
+
+// proxyTarget joins the base URL with the path and query of the request.
+func proxyTarget(baseURL string, r *http.Request) (*url.URL, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy base URL: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid proxy base URL %q", baseURL)
+	}
+	target := *base
+	target.Path = strings.TrimRight(base.Path, "/") + r.URL.Path
+	if r.URL.RawPath != "" {
+		target.RawPath = strings.TrimRight(base.EscapedPath(), "/") + r.URL.RawPath
+	}
+	target.RawQuery = r.URL.RawQuery
+	return &target, nil
+}
+
+// proxyRequest forwards the request to the upstream and relays its response.
+func proxyRequest(w http.ResponseWriter, r *http.Request, body []byte, baseURL string, opts ProxyOptions) {
+	res, err := forwardRequest(r, body, baseURL, opts)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to proxy request: %s", err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Upstream timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Failed to proxy request", http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	if _, err := io.Copy(w, res.Body); err != nil {
+		slog.Error(fmt.Sprintf("Failed to relay upstream response: %s", err))
+	}
+}
+
+// forwardRequest sends the request to the upstream. The response headers have
+// the configured rules applied; the caller closes the body.
+func forwardRequest(r *http.Request, body []byte, baseURL string, opts ProxyOptions) (*http.Response, error) {
+	target, err := proxyTarget(baseURL, r)
+	if err != nil {
+		return nil, err
+	}
+	client, err := proxyClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	timeout := 30 * time.Second
+	if opts.TimeoutMilliseconds > 0 {
+		timeout = time.Duration(opts.TimeoutMilliseconds) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	removeHopByHop(req.Header)
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.Header.Set("X-Forwarded-For", strings.TrimPrefix(req.Header.Get("X-Forwarded-For")+", "+host, ", "))
+	}
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Proto", proto)
+	applyHeaderRules(req.Header, opts.RemoveRequestHeaders, opts.AddRequestHeaders)
+
+	res, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	removeHopByHop(res.Header)
+	applyHeaderRules(res.Header, opts.RemoveResponseHeaders, opts.AddResponseHeaders)
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func removeHopByHop(header http.Header) {
+	for _, f := range header.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+func applyHeaderRules(header http.Header, remove []string, add map[string]string) {
+	for _, name := range remove {
+		header.Del(name)
+	}
+	for name, value := range add {
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,137 @@
+package stubs
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_proxyRequest(t *testing.T) {
+	var got struct {
+		method, uri, body string
+		header            http.Header
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got.method, got.uri, got.body, got.header = r.Method, r.RequestURI, string(b), r.Header
+		w.Header().Set("X-Upstream", "yes")
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("Location", "/elsewhere")
+		w.WriteHeader(http.StatusFound)
+		io.WriteString(w, "from upstream")
+	}))
+	defer upstream.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "http://stubs.local/users/1?expand=true&x=%2F", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "drop me")
+	rec := httptest.NewRecorder()
+	opts := ProxyOptions{
+		AddRequestHeaders:     map[string]string{"X-Api-Key": "k"},
+		RemoveRequestHeaders:  []string{"Cookie"},
+		AddResponseHeaders:    map[string]string{"X-Proxied": "true"},
+		RemoveResponseHeaders: []string{"X-Internal"},
+	}
+	proxyRequest(rec, req, []byte(`{"name": "a"}`), upstream.URL+"/api/", opts)
+
+	if rec.Code != http.StatusFound {
+		t.Errorf("status = %d, want 302 relayed as is", rec.Code)
+	}
+	if body := rec.Body.String(); body != "from upstream" {
+		t.Errorf("body = %q", body)
+	}
+	wantForwarded := []string{http.MethodPost, "/api/users/1?expand=true&x=%2F", `{"name": "a"}`}
+	if diff := cmp.Diff(wantForwarded, []string{got.method, got.uri, got.body}); diff != "" {
+		t.Errorf("forwarded request mismatch (-want +got):\n%s", diff)
+	}
+	for name, want := range map[string]string{
+		"Authorization":     "Bearer token",
+		"X-Api-Key":         "k",
+		"Cookie":            "",
+		"X-Hop":             "",
+		"X-Forwarded-Host":  "stubs.local",
+		"X-Forwarded-Proto": "http",
+		"X-Forwarded-For":   "192.0.2.1",
+	} {
+		if v := got.header.Get(name); v != want {
+			t.Errorf("upstream header %s = %q, want %q", name, v, want)
+		}
+	}
+	for name, want := range map[string]string{"X-Upstream": "yes", "X-Internal": "", "X-Proxied": "true", "Location": "/elsewhere"} {
+		if v := rec.Header().Get(name); v != want {
+			t.Errorf("response header %s = %q, want %q", name, v, want)
+		}
+	}
+}
+
+func Test_proxyRequest_errors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+		opts    ProxyOptions
+		want    int
+	}{
+		{name: "timeout", baseURL: slow.URL, opts: ProxyOptions{TimeoutMilliseconds: 20}, want: http.StatusGatewayTimeout},
+		{name: "unreachable", baseURL: closed.URL, want: http.StatusBadGateway},
+		{name: "invalid base URL", baseURL: "not a url", want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil, tt.baseURL, tt.opts)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func Test_proxyRequest_tls(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer upstream.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ProxyOptions
+		want int
+	}{
+		{name: "unknown certificate", opts: ProxyOptions{}, want: http.StatusBadGateway},
+		{name: "insecure", opts: ProxyOptions{InsecureSkipVerify: true}, want: http.StatusOK},
+		{name: "CA file", opts: ProxyOptions{CAFile: caFile}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil, upstream.URL, tt.opts)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
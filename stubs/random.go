@@ -0,0 +1,68 @@
+package stubs
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+)
+
+// WeightedResponse is a response picked at random in proportion to its weight.
+type WeightedResponse struct {
+	Weight float64 `json:"weight"`
+	Response
+}
+
+// randomPicker picks weighted responses and counts the hits of each variant.
+type randomPicker struct {
+	mu   sync.Mutex
+	rng  *rand.Rand
+	hits map[string][]int
+}
+
+// newRandomPicker seeds the picker for reproducible runs; a seed of 0 picks a
+// random seed.
+func newRandomPicker(seed uint64) *randomPicker {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &randomPicker{rng: rand.New(rand.NewPCG(seed, seed)), hits: make(map[string][]int)}
+}
+
+// pick returns one of the stub's random responses and logs the running hit
+// count of the variant.
+func (p *randomPicker) pick(endpoint Endpoint) Response {
+	variants := endpoint.RandomResponses
+	p.mu.Lock()
+	total := 0.0
+	for _, v := range variants {
+		total += max(v.Weight, 0)
+	}
+	i := 0
+	if total > 0 {
+		x := p.rng.Float64() * total
+		for j, v := range variants {
+			if v.Weight <= 0 {
+				continue
+			}
+			i = j
+			if x < v.Weight {
+				break
+			}
+			x -= v.Weight
+		}
+	} else {
+		i = p.rng.IntN(len(variants))
+	}
+	hits := p.hits[endpoint.ID]
+	if len(hits) != len(variants) {
+		hits = make([]int, len(variants))
+		p.hits[endpoint.ID] = hits
+	}
+	hits[i]++
+	n := hits[i]
+	p.mu.Unlock()
+
+	slog.Info(fmt.Sprintf("Random response %d of %s", i, endpoint.ID), "status", variants[i].Status, "hits", n)
+	return variants[i].Response
+}
@@ -0,0 +1,104 @@
+package stubs
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// silenceLogs discards the per-hit logs of the picker during a test.
+func silenceLogs(t *testing.T) {
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+}
+
+func randomEndpoint(weights ...float64) Endpoint {
+	endpoint := Endpoint{ID: "stub"}
+	for i, w := range weights {
+		endpoint.RandomResponses = append(endpoint.RandomResponses, WeightedResponse{Weight: w, Response: Response{Status: 200 + i}})
+	}
+	return endpoint
+}
+
+func Test_randomPicker(t *testing.T) {
+	silenceLogs(t)
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		// want は 10000 回中の各ステータスの回数の下限と上限
+		want map[int][2]int
+	}{
+		{
+			name:     "weighted",
+			endpoint: randomEndpoint(95, 4, 1),
+			want:     map[int][2]int{200: {9300, 9700}, 201: {250, 550}, 202: {40, 180}},
+		},
+		{
+			name:     "zero weight is never picked",
+			endpoint: randomEndpoint(1, 0, 1),
+			want:     map[int][2]int{200: {4500, 5500}, 202: {4500, 5500}},
+		},
+		{
+			name:     "no weights are picked evenly",
+			endpoint: randomEndpoint(0, 0),
+			want:     map[int][2]int{200: {4500, 5500}, 201: {4500, 5500}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRandomPicker(1)
+			counts := make(map[int]int)
+			for range 10000 {
+				counts[p.pick(tt.endpoint).Status]++
+			}
+			for status, n := range counts {
+				bounds, ok := tt.want[status]
+				if !ok {
+					t.Errorf("status %d picked %d times, want never", status, n)
+					continue
+				}
+				if n < bounds[0] || n > bounds[1] {
+					t.Errorf("status %d picked %d times, want between %d and %d", status, n, bounds[0], bounds[1])
+				}
+			}
+		})
+	}
+}
+
+func Test_randomPicker_seed(t *testing.T) {
+	silenceLogs(t)
+	endpoint := randomEndpoint(1, 1, 1, 1)
+	picks := func(seed uint64) []int {
+		p := newRandomPicker(seed)
+		var statuses []int
+		for range 50 {
+			statuses = append(statuses, p.pick(endpoint).Status)
+		}
+		return statuses
+	}
+	if diff := cmp.Diff(picks(42), picks(42)); diff != "" {
+		t.Errorf("picks with the same seed differ (-first +second):\n%s", diff)
+	}
+	if cmp.Equal(picks(42), picks(43)) {
+		t.Error("picks with different seeds are identical")
+	}
+}
+
+func Test_WeightedResponse_json(t *testing.T) {
+	var got []WeightedResponse
+	if err := json.Unmarshal([]byte(`[{"weight": 95, "status": 200, "body": "ok"}, {"weight": 5, "status": 500}]`), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []WeightedResponse{
+		{Weight: 95, Response: Response{Status: 200, Body: "ok"}},
+		{Weight: 5, Response: Response{Status: 500}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WeightedResponse mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,244 @@
+package stubs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecordOptions control how recorded traffic is turned into stubs.
+type RecordOptions struct {
+	Dir       string       // スタブを書き出すディレクトリ
+	FilesDir  string       // bodyFileName のファイルを書き出すディレクトリ
+	Match     []string     // method と path に加えてマッチャーにする部分 (query, body)
+	BodyLimit int          // これより大きいボディはファイルに書き出す (バイト)
+	Dedupe    bool         // false の場合は同じリクエストの応答を responses に順に追加する
+	Proxy     ProxyOptions // upstream へ転送するときのオプション
+}
+
+var recordMatchParts = []string{"query", "body"}
+
+// Response headers that describe one particular transfer of the body.
+var unrecordedHeaders = []string{"Content-Length", "Date"}
+
+// Extensions for media types whose first registered extension is unusual.
+var bodyFileExtensions = map[string]string{
+	"text/html":  ".html",
+	"text/plain": ".txt",
+	"image/jpeg": ".jpg",
+}
+
+// Recorder proxies requests to the target and writes a stub per unique request.
+type Recorder struct {
+	target string
+	opts   RecordOptions
+
+	mu    sync.Mutex
+	stubs map[string]*Endpoint // スタブのファイル名ごとの記録済みスタブ
+}
+
+// NewRecorder returns a handler that proxies requests to target and records them.
+func NewRecorder(target string, opts RecordOptions) (*Recorder, error) {
+	for _, part := range opts.Match {
+		if !slices.Contains(recordMatchParts, part) {
+			return nil, fmt.Errorf("unknown request part %q, want one of %s", part, strings.Join(recordMatchParts, ", "))
+		}
+	}
+	// bodies are recorded decoded, so let the transport negotiate compression
+	opts.Proxy.RemoveRequestHeaders = append(slices.Clone(opts.Proxy.RemoveRequestHeaders), "Accept-Encoding")
+	return &Recorder{target: target, opts: opts, stubs: map[string]*Endpoint{}}, nil
+}
+
+func (rc *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read request body: %s", err))
+		http.Error(w, "Failed to read request body", 500)
+		return
+	}
+	res, err := forwardRequest(r, body, rc.target, rc.opts.Proxy)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to proxy request: %s", err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Upstream timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Failed to proxy request", http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read upstream response: %s", err))
+		http.Error(w, "Failed to read upstream response", http.StatusBadGateway)
+		return
+	}
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	if _, err := w.Write(resBody); err != nil {
+		slog.Error(fmt.Sprintf("Failed to relay upstream response: %s", err))
+	}
+
+	file, err := rc.record(r, body, res.StatusCode, res.Header, resBody)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to record stub: %s", err))
+		return
+	}
+	if file != "" {
+		slog.Info(fmt.Sprintf("Recorded %s %s to %s", r.Method, r.URL.RequestURI(), file))
+	}
+}
+
+// record writes the exchange as a stub and returns the stub file, or "" when
+// the request had already been recorded.
+func (rc *Recorder) record(r *http.Request, body []byte, status int, header http.Header, resBody []byte) (string, error) {
+	request := rc.stubRequest(r, body)
+	name := stubFileName(request)
+	file := filepath.Join(rc.opts.Dir, name+".json")
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	endpoint, seen := rc.stubs[name]
+	if rc.opts.Dedupe {
+		if seen {
+			return "", nil
+		}
+		// stubs of an earlier recording are kept
+		if _, err := os.Stat(file); err == nil {
+			rc.stubs[name] = &Endpoint{Request: request}
+			return "", nil
+		}
+	}
+
+	if !seen {
+		endpoint = &Endpoint{Request: request}
+	}
+	fileName := name
+	if seen {
+		fileName = fmt.Sprintf("%s-%d", name, len(endpoint.Responses)+1)
+	}
+	response, err := rc.stubResponse(fileName, status, header, resBody)
+	if err != nil {
+		return "", err
+	}
+	// repeated calls become a response sequence
+	switch {
+	case !seen:
+		endpoint.Response = response
+	case len(endpoint.Responses) == 0:
+		endpoint.Responses = []Response{endpoint.Response, response}
+		endpoint.Response = Response{}
+	default:
+		endpoint.Responses = append(endpoint.Responses, response)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode([]Endpoint{*endpoint}); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(rc.opts.Dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		return "", err
+	}
+	rc.stubs[name] = endpoint
+	return file, nil
+}
+
+// stubRequest builds the matchers of a recorded request. Method and path are
+// always matched.
+func (rc *Recorder) stubRequest(r *http.Request, body []byte) Request {
+	request := Request{Method: r.Method, URLPath: r.URL.Path}
+	if slices.Contains(rc.opts.Match, "query") {
+		for k, v := range r.URL.Query() {
+			if request.QueryParameters == nil {
+				request.QueryParameters = map[string]Matcher{}
+			}
+			request.QueryParameters[k] = Matcher{EqualTo: v[0]}
+		}
+	}
+	if slices.Contains(rc.opts.Match, "body") {
+		request.Body = Matcher{EqualTo: string(body)}
+	}
+	return request
+}
+
+// stubResponse builds the response of a recorded stub. Binary and large
+// bodies are written to a file named after the stub.
+func (rc *Recorder) stubResponse(name string, status int, header http.Header, body []byte) (Response, error) {
+	response := Response{Status: status}
+	for k, v := range header {
+		if slices.Contains(unrecordedHeaders, k) {
+			continue
+		}
+		if response.Headers == nil {
+			response.Headers = map[string]HeaderValues{}
+		}
+		response.Headers[k] = HeaderValues(slices.Clone(v))
+	}
+	if bytes.Contains(body, []byte("{{")) {
+		response.Transformaers = []string{"none"}
+	}
+	if utf8.Valid(body) && len(body) <= rc.opts.BodyLimit {
+		response.Body = string(body)
+		return response, nil
+	}
+
+	ext := ".bin"
+	if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if e, ok := bodyFileExtensions[mediaType]; ok {
+			ext = e
+		} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	path := filepath.Join(rc.opts.FilesDir, name+ext)
+	if err := os.MkdirAll(rc.opts.FilesDir, 0o755); err != nil {
+		return Response{}, err
+	}
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return Response{}, err
+	}
+	response.BodyFileName = filepath.ToSlash(path)
+	return response, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// stubFileName names a stub after its method and path, with a hash of all of
+// its matchers so that requests differing in other parts don't collide.
+func stubFileName(request Request) string {
+	key, _ := json.Marshal(request)
+	sum := sha256.Sum256(key)
+	slug := unsafeFileNameChars.ReplaceAllString(strings.Trim(request.URLPath, "/"), "_")
+	if slug == "" {
+		slug = "root"
+	}
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	return fmt.Sprintf("%s-%s-%s", strings.ToLower(request.Method), slug, hex.EncodeToString(sum[:4]))
+}
@@ -0,0 +1,184 @@
+package stubs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func recordUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/users":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Add("Set-Cookie", "a=1")
+			w.Header().Add("Set-Cookie", "b=2")
+			io.WriteString(w, `{"page": "`+r.URL.Query().Get("page")+`", "call": `+strings.Repeat("1", calls)+`}`)
+		case "/template":
+			io.WriteString(w, "{{not a template}}")
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `["`+strings.Repeat("x", 64)+`"]`)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			b, _ := io.ReadAll(r.Body)
+			w.Write(b)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func recordRequests(t *testing.T, opts RecordOptions, requests ...*http.Request) []Endpoint {
+	t.Helper()
+	rc, err := NewRecorder(recordUpstream(t).URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silenceLogs(t)
+	for _, req := range requests {
+		rec := httptest.NewRecorder()
+		rc.ServeHTTP(rec, req)
+		if rec.Code >= 500 {
+			t.Fatalf("%s %s: status %d: %s", req.Method, req.URL, rec.Code, rec.Body)
+		}
+	}
+	endpoints, err := loadConfig(opts.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range endpoints {
+		endpoints[i].ID = ""
+	}
+	return endpoints
+}
+
+func Test_recorder(t *testing.T) {
+	get := func(target string) *http.Request { return httptest.NewRequest(http.MethodGet, target, nil) }
+	post := func(target, body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	}
+	usersResponse := func(page, call string) Response {
+		return Response{
+			Status: 200,
+			Headers: map[string]HeaderValues{
+				"Content-Type": {"application/json"},
+				"Set-Cookie":   {"a=1", "b=2"},
+			},
+			Body: `{"page": "` + page + `", "call": ` + call + `}`,
+		}
+	}
+	tests := []struct {
+		name     string
+		match    []string
+		dedupe   bool
+		requests []*http.Request
+		want     []Endpoint
+	}{
+		{
+			name:     "dedupe keeps the first response",
+			match:    []string{"query"},
+			dedupe:   true,
+			requests: []*http.Request{get("/users?page=2"), get("/users?page=2")},
+			want: []Endpoint{{
+				Request: Request{
+					Method:          "GET",
+					URLPath:         "/users",
+					QueryParameters: map[string]Matcher{"page": {EqualTo: "2"}},
+				},
+				Response: usersResponse("2", "1"),
+			}},
+		},
+		{
+			name:     "repeated calls become a sequence",
+			dedupe:   false,
+			requests: []*http.Request{get("/users?page=1"), get("/users?page=2")},
+			want: []Endpoint{{
+				Request:   Request{Method: "GET", URLPath: "/users"},
+				Responses: []Response{usersResponse("1", "1"), usersResponse("2", "11")},
+			}},
+		},
+		{
+			name:     "body matcher",
+			match:    []string{"body"},
+			dedupe:   true,
+			requests: []*http.Request{post("/orders", `{"sku": "a"}`)},
+			want: []Endpoint{{
+				Request: Request{Method: "POST", URLPath: "/orders", Body: Matcher{EqualTo: `{"sku": "a"}`}},
+				Response: Response{
+					Status:  201,
+					Headers: map[string]HeaderValues{"Content-Type": {"text/plain; charset=utf-8"}},
+					Body:    `{"sku": "a"}`,
+				},
+			}},
+		},
+		{
+			name:     "template syntax is not rendered",
+			dedupe:   true,
+			requests: []*http.Request{get("/template")},
+			want: []Endpoint{{
+				Request: Request{Method: "GET", URLPath: "/template"},
+				Response: Response{
+					Status:        200,
+					Headers:       map[string]HeaderValues{"Content-Type": {"text/plain; charset=utf-8"}},
+					Body:          "{{not a template}}",
+					Transformaers: []string{"none"},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			got := recordRequests(t, RecordOptions{
+				Dir:       filepath.Join(dir, "configs"),
+				FilesDir:  filepath.Join(dir, "files"),
+				Match:     tt.match,
+				BodyLimit: 1024,
+				Dedupe:    tt.dedupe,
+			}, tt.requests...)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("recorded stubs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_recorderBodyFile(t *testing.T) {
+	dir := t.TempDir()
+	got := recordRequests(t, RecordOptions{
+		Dir:       filepath.Join(dir, "configs"),
+		FilesDir:  filepath.Join(dir, "files"),
+		BodyLimit: 16,
+		Dedupe:    true,
+	}, httptest.NewRequest(http.MethodGet, "/large", nil))
+	if len(got) != 1 {
+		t.Fatalf("recorded %d stubs, want 1", len(got))
+	}
+	response := got[0].Response
+	if response.Body != "" || filepath.Ext(response.BodyFileName) != ".json" {
+		t.Fatalf("response = %+v, want the body in a .json file", response)
+	}
+	b, err := os.ReadFile(response.BodyFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["` + strings.Repeat("x", 64) + `"]`; string(b) != want {
+		t.Errorf("body file = %q, want %q", b, want)
+	}
+}
+
+func Test_recorderMatchParts(t *testing.T) {
+	if _, err := NewRecorder("http://example.com", RecordOptions{Match: []string{"headers"}}); err == nil {
+		t.Error("unknown request part was accepted")
+	}
+}
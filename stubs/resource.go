@@ -0,0 +1,291 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resource serves a REST collection from an in-memory store.
+type Resource struct {
+	BasePath string `json:"basePath"`           // コレクションのパス (例: /users)
+	IDField  string `json:"idField,omitempty"`  // 既定値は id
+	SeedFile string `json:"seedFile,omitempty"` // 初期データ (オブジェクトの JSON 配列)
+}
+
+func (r Resource) idField() string {
+	if r.IDField == "" {
+		return "id"
+	}
+	return r.IDField
+}
+
+type collection struct {
+	items  map[string]map[string]any
+	order  []string
+	nextID int
+}
+
+// resources keeps the collections of the resource stubs, keyed by base path.
+type resources struct {
+	mu          sync.Mutex
+	collections map[string]*collection
+}
+
+func newResources() *resources {
+	return &resources{collections: make(map[string]*collection)}
+}
+
+// collection returns the store of a resource, seeding it on first use.
+func (s *resources) collection(resource Resource) (*collection, error) {
+	if c, ok := s.collections[resource.BasePath]; ok {
+		return c, nil
+	}
+	c := &collection{items: make(map[string]map[string]any), nextID: 1}
+	if resource.SeedFile != "" {
+		b, err := os.ReadFile(resource.SeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read seed file: %w", err)
+		}
+		v, err := decodeJSON(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse seed file %s: %w", resource.SeedFile, err)
+		}
+		records, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("seed file %s is not a JSON array", resource.SeedFile)
+		}
+		for _, record := range records {
+			item, ok := record.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("seed file %s has an element that is not an object", resource.SeedFile)
+			}
+			c.insert(resource, item)
+		}
+	}
+	s.collections[resource.BasePath] = c
+	return c, nil
+}
+
+// insert stores an item, assigning the next numeric id when it has none.
+func (c *collection) insert(resource Resource, item map[string]any) string {
+	field := resource.idField()
+	if _, ok := item[field]; !ok {
+		for {
+			id := strconv.Itoa(c.nextID)
+			c.nextID++
+			if _, taken := c.items[id]; !taken {
+				item[field] = json.Number(id)
+				break
+			}
+		}
+	}
+	id := valueString(item[field])
+	if n, err := strconv.Atoi(id); err == nil && n >= c.nextID {
+		c.nextID = n + 1
+	}
+	if _, ok := c.items[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.items[id] = item
+	return id
+}
+
+func (c *collection) list() []any {
+	list := make([]any, 0, len(c.order))
+	for _, id := range c.order {
+		list = append(list, c.items[id])
+	}
+	return list
+}
+
+func (c *collection) delete(id string) {
+	delete(c.items, id)
+	c.order = slices.DeleteFunc(c.order, func(s string) bool { return s == id })
+}
+
+// reset drops every change, so collections are seeded again on next use.
+func (s *resources) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.collections)
+}
+
+// serve answers the request from the first resource whose base path matches.
+// It reports false when no resource does.
+func (s *resources) serve(w http.ResponseWriter, r *http.Request, body []byte, endpoints []Endpoint) bool {
+	requestPath := strings.TrimRight(r.URL.Path, "/")
+	for _, endpoint := range endpoints {
+		resource := endpoint.Resource
+		if resource == nil {
+			continue
+		}
+		basePath := strings.TrimRight(resource.BasePath, "/")
+		id := ""
+		switch {
+		case requestPath == basePath:
+		case strings.HasPrefix(requestPath, basePath+"/") && !strings.Contains(requestPath[len(basePath)+1:], "/"):
+			id = requestPath[len(basePath)+1:]
+		default:
+			continue
+		}
+		journalStub(r.Context(), endpoint.ID)
+		s.serveResource(w, r, body, *resource, id)
+		return true
+	}
+	return false
+}
+
+func (s *resources) serveResource(w http.ResponseWriter, r *http.Request, body []byte, resource Resource, id string) {
+	s.answer(r.Method, body, resource, id).write(w)
+}
+
+// resourceReply is the answer to a resource request. It is built while the
+// resources are locked and written after, so a slow client holds up no one.
+type resourceReply struct {
+	status int
+	header http.Header
+	body   []byte // 成功時は JSON、エラー時はメッセージ
+}
+
+func resourceJSON(status int, v any) resourceReply {
+	b, err := json.Marshal(v)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to write resource: %s", err))
+		return resourceError(http.StatusInternalServerError, "Failed to write resource")
+	}
+	return resourceReply{status: status, header: http.Header{"Content-Type": {"application/json"}}, body: append(b, '\n')}
+}
+
+func resourceError(status int, message string) resourceReply {
+	return resourceReply{status: status, header: http.Header{}, body: []byte(message)}
+}
+
+func (rr resourceReply) write(w http.ResponseWriter) {
+	for k, v := range rr.header {
+		w.Header()[k] = v
+	}
+	if rr.status >= 400 {
+		http.Error(w, string(rr.body), rr.status)
+		return
+	}
+	w.WriteHeader(rr.status)
+	if _, err := w.Write(rr.body); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write resource: %s", err))
+	}
+}
+
+// answer applies the request to the resource's collection.
+func (s *resources) answer(method string, body []byte, resource Resource, id string) resourceReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.collection(resource)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load resource %s: %s", resource.BasePath, err))
+		return resourceError(http.StatusInternalServerError, "Failed to load resource")
+	}
+	field := resource.idField()
+
+	if id == "" {
+		switch method {
+		case http.MethodGet:
+			return resourceJSON(http.StatusOK, c.list())
+		case http.MethodPost:
+			item, ok := decodeResourceItem(body)
+			if !ok {
+				return resourceError(http.StatusBadRequest, "Request body must be a JSON object")
+			}
+			if v, ok := item[field]; ok {
+				if _, exists := c.items[valueString(v)]; exists {
+					return resourceError(http.StatusConflict, fmt.Sprintf("%s %s already exists", field, valueString(v)))
+				}
+			}
+			newID := c.insert(resource, item)
+			reply := resourceJSON(http.StatusCreated, item)
+			if reply.status == http.StatusCreated {
+				reply.header.Set("Location", path.Join(resource.BasePath, newID))
+			}
+			return reply
+		default:
+			reply := resourceError(http.StatusMethodNotAllowed, "Method not allowed")
+			reply.header.Set("Allow", "GET, POST")
+			return reply
+		}
+	}
+
+	current, exists := c.items[id]
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if !exists {
+			return resourceError(http.StatusNotFound, "Not found")
+		}
+	default:
+		reply := resourceError(http.StatusMethodNotAllowed, "Method not allowed")
+		reply.header.Set("Allow", "GET, PUT, PATCH, DELETE")
+		return reply
+	}
+	switch method {
+	case http.MethodPut, http.MethodPatch:
+		item, ok := decodeResourceItem(body)
+		if !ok {
+			return resourceError(http.StatusBadRequest, "Request body must be a JSON object")
+		}
+		if method == http.MethodPatch {
+			item = mergePatch(current, item).(map[string]any)
+		}
+		if v, ok := item[field]; ok && valueString(v) != id {
+			return resourceError(http.StatusConflict, fmt.Sprintf("%s can't be changed", field))
+		}
+		item[field] = current[field]
+		c.items[id] = item
+		return resourceJSON(http.StatusOK, item)
+	case http.MethodDelete:
+		c.delete(id)
+		return resourceReply{status: http.StatusNoContent, header: http.Header{}}
+	}
+	return resourceJSON(http.StatusOK, current)
+}
+
+func decodeResourceItem(body []byte) (map[string]any, bool) {
+	v, err := decodeJSON(body)
+	item, ok := v.(map[string]any)
+	return item, err == nil && ok
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	merged := make(map[string]any, len(t))
+	if ok {
+		for k, v := range t {
+			merged[k] = v
+		}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergePatch(merged[k], v)
+	}
+	return merged
+}
+
+// register adds the resource API to mux.
+func (s *resources) register(mux *http.ServeMux) {
+	mux.HandleFunc("DELETE /__admin/resources", func(w http.ResponseWriter, r *http.Request) {
+		s.reset()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
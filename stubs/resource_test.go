@@ -0,0 +1,116 @@
+package stubs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_resources(t *testing.T) {
+	s := newResources()
+	endpoints := []Endpoint{
+		{Resource: &Resource{BasePath: "/users", SeedFile: "testdata/users.json"}},
+		{Resource: &Resource{BasePath: "/api/orders/", IDField: "orderId"}},
+	}
+	steps := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "list seeded", method: "GET", path: "/users", wantStatus: 200, wantBody: `[{"id":1,"name":"Alice","role":"admin"},{"id":2,"name":"Bob","role":"user"}]`},
+		{name: "get one", method: "GET", path: "/users/2", wantStatus: 200, wantBody: `{"id":2,"name":"Bob","role":"user"}`},
+		{name: "get missing", method: "GET", path: "/users/9", wantStatus: 404},
+		{name: "create", method: "POST", path: "/users", body: `{"name": "Carol"}`, wantStatus: 201, wantBody: `{"id":3,"name":"Carol"}`, wantLocation: "/users/3"},
+		{name: "create duplicate", method: "POST", path: "/users", body: `{"id": 1, "name": "Eve"}`, wantStatus: 409},
+		{name: "create invalid", method: "POST", path: "/users", body: `[1]`, wantStatus: 400},
+		{name: "replace", method: "PUT", path: "/users/3", body: `{"name": "Caroline"}`, wantStatus: 200, wantBody: `{"id":3,"name":"Caroline"}`},
+		{name: "replace missing", method: "PUT", path: "/users/9", body: `{"name": "x"}`, wantStatus: 404},
+		{name: "change id", method: "PUT", path: "/users/3", body: `{"id": 4}`, wantStatus: 409},
+		{name: "patch", method: "PATCH", path: "/users/1", body: `{"role": null, "email": "alice@example.com"}`, wantStatus: 200, wantBody: `{"email":"alice@example.com","id":1,"name":"Alice"}`},
+		{name: "delete", method: "DELETE", path: "/users/2", wantStatus: 204},
+		{name: "delete again", method: "DELETE", path: "/users/2", wantStatus: 404},
+		{name: "list after writes", method: "GET", path: "/users/", wantStatus: 200, wantBody: `[{"email":"alice@example.com","id":1,"name":"Alice"},{"id":3,"name":"Caroline"}]`},
+		{name: "method not allowed", method: "DELETE", path: "/users", wantStatus: 405},
+		{name: "custom id field", method: "POST", path: "/api/orders", body: `{"orderId": "A-1"}`, wantStatus: 201, wantBody: `{"orderId":"A-1"}`, wantLocation: "/api/orders/A-1"},
+		{name: "empty collection", method: "POST", path: "/api/orders", body: `{}`, wantStatus: 201, wantBody: `{"orderId":1}`, wantLocation: "/api/orders/1"},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(step.method, step.path, nil)
+		if !s.serve(rec, req, []byte(step.body), endpoints) {
+			t.Fatalf("%s: not served", step.name)
+		}
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d (%s)", step.name, rec.Code, step.wantStatus, rec.Body)
+		}
+		if step.wantBody != "" {
+			if diff := cmp.Diff(step.wantBody, strings.TrimSpace(rec.Body.String())); diff != "" {
+				t.Errorf("%s: body mismatch (-want +got):\n%s", step.name, diff)
+			}
+		}
+		if got := rec.Header().Get("Location"); got != step.wantLocation {
+			t.Errorf("%s: Location = %q, want %q", step.name, got, step.wantLocation)
+		}
+	}
+
+	for _, path := range []string{"/userss", "/users/1/posts", "/other"} {
+		rec := httptest.NewRecorder()
+		if s.serve(rec, httptest.NewRequest(http.MethodGet, path, nil), nil, endpoints) {
+			t.Errorf("%s: served, want no resource", path)
+		}
+	}
+}
+
+// stalledWriter blocks writes until release is closed, like a client that
+// stopped reading.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func Test_resourcesStalledClient(t *testing.T) {
+	s := newResources()
+	endpoints := []Endpoint{
+		{Resource: &Resource{BasePath: "/users", SeedFile: "testdata/users.json"}},
+		{Resource: &Resource{BasePath: "/orders"}},
+	}
+	stalled := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(stalled, httptest.NewRequest(http.MethodGet, "/users", nil), nil, endpoints)
+	}()
+	<-stalled.writing
+
+	answered := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		s.serve(rec, httptest.NewRequest(http.MethodPost, "/orders", nil), []byte(`{"item":"book"}`), endpoints)
+		answered <- rec.Code
+	}()
+	select {
+	case code := <-answered:
+		if code != http.StatusCreated {
+			t.Errorf("POST /orders = %d, want 201", code)
+		}
+	case <-time.After(time.Second):
+		t.Error("POST /orders waited for the stalled client")
+	}
+	close(stalled.release)
+	<-done
+}
@@ -0,0 +1,170 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// scenarioStarted is the state of every scenario until a stub moves it on.
+const scenarioStarted = "Started"
+
+// scenarios keeps the state of the scenarios shared by stubs.
+type scenarios struct {
+	mu     sync.Mutex
+	states map[string]string
+	load   func() ([]Endpoint, error) // 一覧に載せるシナリオを設定から読み込む
+}
+
+func newScenarios(load func() ([]Endpoint, error)) *scenarios {
+	return &scenarios{states: make(map[string]string), load: load}
+}
+
+func (s *scenarios) state(name string) string {
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return scenarioStarted
+}
+
+// matches reports whether the scenario of the stub is in its required state.
+func (s *scenarios) matches(endpoint Endpoint) bool {
+	if endpoint.ScenarioName == "" || endpoint.RequiredScenarioState == "" {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state(endpoint.ScenarioName) == endpoint.RequiredScenarioState
+}
+
+// transition moves the scenario of a served stub to its new state. The required
+// state is checked again so that concurrent requests can't both make the same
+// transition.
+func (s *scenarios) transition(endpoint Endpoint) bool {
+	if endpoint.ScenarioName == "" {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if endpoint.RequiredScenarioState != "" && s.state(endpoint.ScenarioName) != endpoint.RequiredScenarioState {
+		return false
+	}
+	if endpoint.NewScenarioState != "" {
+		s.states[endpoint.ScenarioName] = endpoint.NewScenarioState
+	}
+	return true
+}
+
+// reset returns a scenario, or every scenario when name is empty, to Started.
+func (s *scenarios) reset(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		clear(s.states)
+		return
+	}
+	delete(s.states, name)
+}
+
+func (s *scenarios) set(name, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[name] = state
+}
+
+type scenarioStatus struct {
+	Name           string   `json:"name"`
+	State          string   `json:"state"`
+	PossibleStates []string `json:"possibleStates"`
+}
+
+// list returns the scenarios of the stubs and those set over the API.
+func (s *scenarios) list() ([]scenarioStatus, error) {
+	possible := make(map[string][]string)
+	if s.load != nil {
+		endpoints, err := s.load()
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.ScenarioName == "" {
+				continue
+			}
+			states := possible[endpoint.ScenarioName]
+			for _, state := range []string{scenarioStarted, endpoint.RequiredScenarioState, endpoint.NewScenarioState} {
+				if state != "" && !slices.Contains(states, state) {
+					states = append(states, state)
+				}
+			}
+			possible[endpoint.ScenarioName] = states
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.states {
+		if _, ok := possible[name]; !ok {
+			possible[name] = []string{scenarioStarted}
+		}
+	}
+	list := make([]scenarioStatus, 0, len(possible))
+	for name, states := range possible {
+		state := s.state(name)
+		if !slices.Contains(states, state) {
+			states = append(states, state)
+		}
+		list = append(list, scenarioStatus{Name: name, State: state, PossibleStates: states})
+	}
+	slices.SortFunc(list, func(a, b scenarioStatus) int {
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		}
+		return 0
+	})
+	return list, nil
+}
+
+// register adds the scenario API to mux.
+func (s *scenarios) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /__admin/scenarios", s.handleList)
+	mux.HandleFunc("DELETE /__admin/scenarios", s.handleReset)
+	mux.HandleFunc("DELETE /__admin/scenarios/{name}", s.handleReset)
+	mux.HandleFunc("PUT /__admin/scenarios/{name}/state", s.handleSetState)
+}
+
+func (s *scenarios) handleList(w http.ResponseWriter, r *http.Request) {
+	list, err := s.list()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load configuration: %v", err))
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write scenarios: %s", err))
+	}
+}
+
+func (s *scenarios) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.reset(r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetState answers PUT /__admin/scenarios/{name}/state with {"state": "..."}.
+func (s *scenarios) handleSetState(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.State == "" {
+		http.Error(w, `Body must be {"state": "<state>"}`, http.StatusBadRequest)
+		return
+	}
+	s.set(r.PathValue("name"), body.State)
+	w.WriteHeader(http.StatusNoContent)
+}
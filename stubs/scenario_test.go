@@ -0,0 +1,121 @@
+package stubs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var cartStubs = []Endpoint{
+	{ScenarioName: "cart", RequiredScenarioState: "Started", Response: Response{Body: "empty"}},
+	{ScenarioName: "cart", RequiredScenarioState: "Started", NewScenarioState: "item added", Response: Response{Status: 201}},
+	{ScenarioName: "cart", RequiredScenarioState: "item added", Response: Response{Body: "1 item"}},
+	{ScenarioName: "cart", RequiredScenarioState: "item added", NewScenarioState: "checked out", Response: Response{Status: 200}},
+	{ScenarioName: "login", NewScenarioState: "logged in"},
+}
+
+func Test_scenarios(t *testing.T) {
+	s := newScenarios(nil)
+	getCart, addItem, getCartWithItem, checkout := cartStubs[0], cartStubs[1], cartStubs[2], cartStubs[3]
+
+	steps := []struct {
+		name     string
+		endpoint Endpoint
+		want     bool
+	}{
+		{name: "cart is empty", endpoint: getCart, want: true},
+		{name: "no item yet", endpoint: getCartWithItem, want: false},
+		{name: "add item", endpoint: addItem, want: true},
+		{name: "cart is no longer empty", endpoint: getCart, want: false},
+		{name: "cart has the item", endpoint: getCartWithItem, want: true},
+		{name: "check out", endpoint: checkout, want: true},
+		{name: "checked out", endpoint: getCartWithItem, want: false},
+		{name: "no required state", endpoint: cartStubs[4], want: true},
+	}
+	for _, step := range steps {
+		got := s.matches(step.endpoint) && s.transition(step.endpoint)
+		if got != step.want {
+			t.Fatalf("%s: matched = %v, want %v", step.name, got, step.want)
+		}
+	}
+	if !s.matches(Endpoint{Response: Response{Status: 200}}) {
+		t.Error("stubs without a scenario must always match")
+	}
+}
+
+func Test_scenarios_concurrentTransition(t *testing.T) {
+	s := newScenarios(nil)
+	addItem := cartStubs[1]
+	var won atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.transition(addItem) {
+				won.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if won.Load() != 1 {
+		t.Errorf("%d requests made the transition, want 1", won.Load())
+	}
+}
+
+func Test_scenarios_api(t *testing.T) {
+	s := newScenarios(func() ([]Endpoint, error) { return cartStubs, nil })
+	mux := muxOf(s.register)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	type status struct {
+		Name           string   `json:"name"`
+		State          string   `json:"state"`
+		PossibleStates []string `json:"possibleStates"`
+	}
+	list := func() []status {
+		var got []status
+		if err := json.NewDecoder(do(http.MethodGet, "/__admin/scenarios", "").Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	s.transition(cartStubs[1])
+	want := []status{
+		{Name: "cart", State: "item added", PossibleStates: []string{"Started", "item added", "checked out"}},
+		{Name: "login", State: "Started", PossibleStates: []string{"Started", "logged in"}},
+	}
+	if diff := cmp.Diff(want, list()); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+
+	if rec := do(http.MethodPut, "/__admin/scenarios/login/state", `{"state": "logged in"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT state = %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/__admin/scenarios/login/state", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT without state = %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/__admin/scenarios/cart", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE cart = %d", rec.Code)
+	}
+	want[0].State, want[1].State = "Started", "logged in"
+	if diff := cmp.Diff(want, list()); diff != "" {
+		t.Errorf("list after reset of cart mismatch (-want +got):\n%s", diff)
+	}
+
+	do(http.MethodDelete, "/__admin/scenarios", "")
+	want[1].State = "Started"
+	if diff := cmp.Diff(want, list()); diff != "" {
+		t.Errorf("list after reset mismatch (-want +got):\n%s", diff)
+	}
+}
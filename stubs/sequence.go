@@ -0,0 +1,99 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// What a stub with responses answers once every response has been served.
+const (
+	sequenceRepeatLast  = "repeatLast"  // 最後のレスポンスを返し続ける (既定値)
+	sequenceCycle       = "cycle"       // 最初のレスポンスに戻る
+	sequenceFallThrough = "fallThrough" // 一致しなかったものとして次のスタブに進む
+)
+
+// sequenceCounters counts the calls served by each stub with a response sequence.
+type sequenceCounters struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newSequenceCounters() *sequenceCounters {
+	return &sequenceCounters{counts: make(map[string]int)}
+}
+
+// next returns the response for the stub's next call. It reports false once a
+// fallThrough sequence is exhausted.
+func (s *sequenceCounters) next(endpoint Endpoint) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.counts[endpoint.ID]
+	responses := endpoint.Responses
+	if n >= len(responses) {
+		switch endpoint.SequenceEnd {
+		case sequenceCycle:
+			n %= len(responses)
+		case sequenceFallThrough:
+			return Response{}, false
+		default:
+			n = len(responses) - 1
+		}
+	}
+	s.counts[endpoint.ID]++
+	return responses[n], true
+}
+
+// rewind gives back the call counted by next, for a request the stub did not
+// answer after all.
+func (s *sequenceCounters) rewind(endpoint Endpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[endpoint.ID] > 0 {
+		s.counts[endpoint.ID]--
+	}
+}
+
+// reset restarts the sequence of a stub, or of every stub when id is empty.
+func (s *sequenceCounters) reset(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == "" {
+		clear(s.counts)
+		return
+	}
+	delete(s.counts, id)
+}
+
+func (s *sequenceCounters) snapshot() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.counts))
+	for id, n := range s.counts {
+		counts[id] = n
+	}
+	return counts
+}
+
+// register adds the sequence API to mux.
+func (s *sequenceCounters) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /__admin/sequences", s.handleList)
+	mux.HandleFunc("DELETE /__admin/sequences", s.handleReset)
+	mux.HandleFunc("DELETE /__admin/sequences/{id...}", s.handleReset)
+}
+
+// handleList answers GET /__admin/sequences with the calls served per stub.
+func (s *sequenceCounters) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.snapshot()); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write sequences: %s", err))
+	}
+}
+
+// handleReset answers DELETE /__admin/sequences and DELETE /__admin/sequences/{id}.
+func (s *sequenceCounters) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.reset(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
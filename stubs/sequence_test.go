@@ -0,0 +1,135 @@
+package stubs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func sequenceEndpoint(id, end string) Endpoint {
+	return Endpoint{
+		ID:          id,
+		Responses:   []Response{{Status: 503}, {Status: 503}, {Status: 200}},
+		SequenceEnd: end,
+	}
+}
+
+func Test_sequenceCounters_next(t *testing.T) {
+	tests := []struct {
+		name string
+		end  string
+		want []int // 0 は一致しなかったことを表す
+	}{
+		{name: "repeat last by default", end: "", want: []int{503, 503, 200, 200, 200}},
+		{name: "repeat last", end: "repeatLast", want: []int{503, 503, 200, 200, 200}},
+		{name: "cycle", end: "cycle", want: []int{503, 503, 200, 503, 503, 200}},
+		{name: "fall through", end: "fallThrough", want: []int{503, 503, 200, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSequenceCounters()
+			endpoint := sequenceEndpoint("stub", tt.end)
+			var got []int
+			for range tt.want {
+				response, ok := s.next(endpoint)
+				if !ok {
+					got = append(got, 0)
+					continue
+				}
+				got = append(got, response.Status)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("next() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_sequenceCounters_concurrent(t *testing.T) {
+	s := newSequenceCounters()
+	endpoint := sequenceEndpoint("stub", "fallThrough")
+	var mu sync.Mutex
+	statuses := make(map[int]int)
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := 0
+			if response, ok := s.next(endpoint); ok {
+				status = response.Status
+			}
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if diff := cmp.Diff(map[int]int{503: 2, 200: 1, 0: 47}, statuses); diff != "" {
+		t.Errorf("concurrent next() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_sequenceCounters_api(t *testing.T) {
+	s := newSequenceCounters()
+	mux := muxOf(s.register)
+	a := sequenceEndpoint("configs/a.json#0", "")
+	b := sequenceEndpoint("b", "")
+	s.next(a)
+	s.next(a)
+	s.next(b)
+
+	list := func() map[string]int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__admin/sequences", nil))
+		got := make(map[string]int)
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	del := func(path string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("DELETE %s = %d", path, rec.Code)
+		}
+	}
+
+	if diff := cmp.Diff(map[string]int{"configs/a.json#0": 2, "b": 1}, list()); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+	del("/__admin/sequences/configs/a.json%230")
+	if diff := cmp.Diff(map[string]int{"b": 1}, list()); diff != "" {
+		t.Errorf("list after reset of one stub mismatch (-want +got):\n%s", diff)
+	}
+	if response, _ := s.next(a); response.Status != 503 {
+		t.Errorf("next() after reset = %d, want 503", response.Status)
+	}
+	del("/__admin/sequences")
+	if diff := cmp.Diff(map[string]int{}, list()); diff != "" {
+		t.Errorf("list after reset mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_sequenceCounters_rewind(t *testing.T) {
+	s := newSequenceCounters()
+	endpoint := sequenceEndpoint("stub", "")
+	// a rewind before any call is a no-op
+	s.rewind(endpoint)
+	var got []int
+	for _, rewind := range []bool{false, true, false, false} {
+		response, _ := s.next(endpoint)
+		got = append(got, response.Status)
+		if rewind {
+			s.rewind(endpoint)
+		}
+	}
+	if diff := cmp.Diff([]int{503, 503, 503, 200}, got); diff != "" {
+		t.Errorf("next() after rewind mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,336 @@
+package stubs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Options configure a Server.
+type Options struct {
+	Dir            string        // スタブを読み込むディレクトリ。リクエストごとに読み直す
+	Endpoints      []Endpoint    // Dir のスタブの後に照合するスタブ
+	DescriptorSets []string      // gRPC スタブ用の FileDescriptorSet ファイル
+	Delay          time.Duration // すべての応答に加える遅延
+	ProxyURL       string        // どのスタブにも一致しないリクエストの転送先
+	Proxy          ProxyOptions  // ProxyURL への転送のオプション
+	Seed           uint64        // randomResponses のシード。0 の場合はランダム
+
+	JournalFile      string // リクエストのジャーナルを追記するファイル。空の場合は書き出さない
+	JournalMaxSize   int64  // ジャーナルのファイルをローテーションするサイズ (バイト)。0 の場合はローテーションしない
+	JournalMaxFiles  int    // ローテーションしたファイルを残す数
+	JournalSize      int    // メモリに残すリクエストの数。0 の場合は 1000、負の場合は残さない
+	JournalBodyLimit int    // ジャーナルに残すボディの長さ (バイト)。0 の場合は 8192、負の場合は制限しない
+
+	AdminToken    string // 指定されている場合は /__admin に Bearer トークンを要求する
+	AdminPersist  bool   // /__admin で変更したスタブを Dir のファイルに書き戻す
+	SeparateAdmin bool   // true の場合は ServeHTTP で /__admin を扱わない。AdminHandler を別のポートで公開する
+}
+
+// Server matches requests against stubs and answers them. It is an
+// http.Handler that also serves the /__admin API.
+type Server struct {
+	opts        Options
+	files       *protoregistry.Files
+	stubs       *stubStore
+	sequences   *sequenceCounters
+	random      *randomPicker
+	states      *scenarios
+	collections *resources
+	journal     *journal
+	journalFile *rotatingFile
+	admin       http.Handler
+	mux         *http.ServeMux
+}
+
+// NewServer creates a server answering from the stubs in opts.Dir and opts.Endpoints.
+func NewServer(opts Options) (*Server, error) {
+	if opts.AdminPersist && opts.Dir == "" {
+		return nil, errors.New("AdminPersist requires Dir")
+	}
+	for i, e := range opts.Endpoints {
+		if err := validateEndpoint(e); err != nil {
+			return nil, fmt.Errorf("invalid stub %d: %w", i, err)
+		}
+	}
+	s := &Server{opts: opts}
+	if len(opts.DescriptorSets) > 0 {
+		files, err := loadDescriptorSets(opts.DescriptorSets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load descriptor sets: %w", err)
+		}
+		s.files = files
+	}
+	var sink io.Writer
+	if opts.JournalFile != "" {
+		f, err := openRotatingFile(opts.JournalFile, opts.JournalMaxSize, opts.JournalMaxFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open request journal: %w", err)
+		}
+		s.journalFile, sink = f, f
+	}
+	journalSize := opts.JournalSize
+	if journalSize == 0 {
+		journalSize = 1000
+	}
+	bodyLimit := opts.JournalBodyLimit
+	if bodyLimit == 0 {
+		bodyLimit = 8192
+	}
+
+	s.journal = newJournal(journalSize, bodyLimit, sink)
+	s.stubs = newStubStore(opts.Dir, opts.Endpoints, opts.AdminPersist)
+	s.sequences = newSequenceCounters()
+	s.random = newRandomPicker(opts.Seed)
+	s.states = newScenarios(s.stubs.endpoints)
+	s.collections = newResources()
+
+	admin := http.NewServeMux()
+	s.stubs.register(admin)
+	s.sequences.register(admin)
+	s.states.register(admin)
+	s.collections.register(admin)
+	s.journal.register(admin)
+	s.admin = requireToken(opts.AdminToken, admin)
+
+	s.mux = http.NewServeMux()
+	if !opts.SeparateAdmin {
+		s.mux.Handle("/__admin/", s.admin)
+	}
+	s.mux.Handle("/", s.journal.middleware(http.HandlerFunc(s.serveStub)))
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// AdminHandler serves the /__admin API, for use with Options.SeparateAdmin.
+func (s *Server) AdminHandler() http.Handler {
+	return s.admin
+}
+
+// Stubs returns the stubs in the order they are matched.
+func (s *Server) Stubs() ([]Endpoint, error) {
+	return s.stubs.endpoints()
+}
+
+// AddStub adds a stub in front of the others, as POST /__admin/stubs does.
+// Stubs that would fail every request they match are rejected.
+func (s *Server) AddStub(e Endpoint) (Endpoint, error) {
+	if err := validateEndpoint(e); err != nil {
+		return Endpoint{}, fmt.Errorf("invalid stub: %w", err)
+	}
+	return s.stubs.create(e)
+}
+
+// Requests returns the journaled requests in memory, oldest first.
+func (s *Server) Requests() []JournalEntry {
+	return s.journal.list()
+}
+
+// Verify matches the journaled requests in memory against v. It returns an
+// error when v has an invalid pattern.
+func (s *Server) Verify(v Verification) (VerificationResult, error) {
+	return s.journal.verify(v)
+}
+
+// Reset drops the stubs changed at runtime and clears the journal, response
+// sequences, scenarios and resources.
+func (s *Server) Reset() {
+	s.stubs.reset()
+	s.journal.clear()
+	s.sequences.reset("")
+	s.states.reset("")
+	s.collections.reset()
+}
+
+// Close closes the journal file.
+func (s *Server) Close() error {
+	if s.journalFile == nil {
+		return nil
+	}
+	return s.journalFile.Close()
+}
+
+// serveStub answers the request from the first matching stub.
+func (s *Server) serveStub(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := s.stubs.endpoints()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load configuration: %v", err))
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to read request body: %s", err))
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	if err := sleepContext(r.Context(), s.opts.Delay); err != nil {
+		return
+	}
+	if isGRPC(r) {
+		serveGRPC(w, r, body, endpoints, s.files)
+		return
+	}
+	// challenges of stubs that matched everything but the missing credentials
+	var challenges []string
+	for _, endpoint := range endpoints {
+		isMatchPath, pathMap := pathMatcher(endpoint, r.URL.RawPath, r.URL.Path)
+		if endpoint.Request.JSONRPC != nil {
+			// JSON-RPC calls are dispatched on the method in the body, not on the URL
+			if r.Method == endpoint.Request.Method && isMatchPath {
+				serveJSONRPC(w, r, body, endpoints)
+				return
+			}
+			continue
+		}
+		isMatchQuery := queryMatcher(endpoint, r.URL.Query())
+		isMatchBody := bodyMatcher(endpoint, string(body))
+		isMatchGraphQL := graphqlMatcher(endpoint, r.URL.Query(), string(body))
+		isMatchSOAP := soapMatcher(endpoint, r.Header, string(body))
+		isMatchScenario := s.states.matches(endpoint)
+		if r.Method == endpoint.Request.Method && isMatchPath && isMatchQuery && isMatchBody && isMatchGraphQL && isMatchSOAP && isMatchScenario {
+			isMatchAuth, challenge := authMatcher(endpoint, r.Header.Get("Authorization"))
+			if !isMatchAuth {
+				if challenge != "" && !slices.Contains(challenges, challenge) {
+					challenges = append(challenges, challenge)
+				}
+				continue
+			}
+			switch {
+			case len(endpoint.Responses) > 0:
+				response, ok := s.sequences.next(endpoint)
+				if !ok {
+					continue
+				}
+				endpoint.Response = response
+			case len(endpoint.RandomResponses) > 0:
+				endpoint.Response = s.random.pick(endpoint)
+			}
+			if !s.states.transition(endpoint) {
+				// another request moved the scenario on in the meantime
+				if len(endpoint.Responses) > 0 {
+					s.sequences.rewind(endpoint)
+				}
+				continue
+			}
+			journalStub(r.Context(), endpoint.ID)
+
+			q := make(map[string]string)
+			for k, v := range r.URL.Query() {
+				q[k] = v[0]
+			}
+			gp := TemplateData{
+				Query: q,
+				Path:  pathMap,
+				Body:  string(body),
+				JSON:  parseJSONBody(body),
+			}
+			if err := sleepContext(r.Context(), responseDelay(endpoint.Response)); err != nil {
+				return
+			}
+			if endpoint.Response.ProxyBaseURL != "" {
+				var opts ProxyOptions
+				if endpoint.Response.Proxy != nil {
+					opts = *endpoint.Response.Proxy
+				}
+				proxyRequest(w, r, body, endpoint.Response.ProxyBaseURL, opts)
+				return
+			}
+			responseBody, err := bodySource(endpoint.Response)
+			if err != nil {
+				slog.Error(fmt.Sprintf("Failed to read response body: %s", err))
+				http.Error(w, "Failed to read response body", http.StatusInternalServerError)
+				return
+			}
+			if len(endpoint.Response.GraphQLErrors) > 0 {
+				responseBody, err = graphqlErrorBody(endpoint.Response.GraphQLErrors, responseBody)
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to build GraphQL errors: %s", err))
+					http.Error(w, "Failed to build GraphQL errors", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+			}
+			status := endpoint.Response.Status
+			if endpoint.Response.Dataset != nil {
+				var datasetStatus int
+				responseBody, datasetStatus, err = queryDataset(endpoint, r.URL.Path, r.URL.Query())
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to query dataset: %s", err))
+					http.Error(w, "Failed to query dataset", http.StatusInternalServerError)
+					return
+				}
+				if status == 0 || datasetStatus != http.StatusOK {
+					status = datasetStatus
+				}
+			}
+			if endpoint.Request.SOAP != nil || endpoint.Response.SOAP != nil {
+				version := soapResponseVersion(endpoint, body)
+				responseBody, err = soapResponseBody(version, endpoint.Response, responseBody)
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to build SOAP envelope: %s", err))
+					http.Error(w, "Failed to build SOAP envelope", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", soapContentType(version))
+				if status == 0 && endpoint.Response.SOAP != nil && endpoint.Response.SOAP.Fault != nil {
+					status = http.StatusInternalServerError
+				}
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if err := applyHeaders(w.Header(), endpoint.Response.Headers, gp); err != nil {
+				slog.Error(fmt.Sprintf("Failed to render response headers: %s", err))
+				http.Error(w, "Failed to render response headers", http.StatusInternalServerError)
+				return
+			}
+			tr := &TransformedResponse{Status: status, Header: w.Header(), Body: []byte(responseBody), Data: gp}
+			if err := transform(endpoint.Response, tr); err != nil {
+				slog.Error(fmt.Sprintf("Failed to transform response: %s", err))
+				http.Error(w, "Failed to transform response", http.StatusInternalServerError)
+				return
+			}
+			if w.Header().Get("Content-Type") == "" {
+				if contentType := defaultContentType(endpoint.Response, string(tr.Body)); contentType != "" {
+					w.Header().Set("Content-Type", contentType)
+				}
+			}
+			if endpoint.Response.Fault != "" {
+				if err := injectFault(w, r, endpoint.Response.Fault, tr); err != nil {
+					slog.Error(fmt.Sprintf("Failed to inject fault: %s", err))
+					http.Error(w, "Failed to inject fault", http.StatusInternalServerError)
+				}
+				return
+			}
+			w.WriteHeader(tr.Status)
+			if err := writeBody(r.Context(), w, endpoint.Response, tr.Body); err != nil {
+				slog.Error(fmt.Sprintf("Failed to write response body: %s", err))
+			}
+			return
+		}
+	}
+	if len(challenges) > 0 {
+		for _, challenge := range challenges {
+			w.Header().Add("WWW-Authenticate", challenge)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// resources answer what no stub did, so stubs can override single routes
+	if s.collections.serve(w, r, body, endpoints) {
+		return
+	}
+	if s.opts.ProxyURL != "" {
+		proxyRequest(w, r, body, s.opts.ProxyURL, s.opts.Proxy)
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,115 @@
+package stubs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Server(t *testing.T) {
+	silenceLogs(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stubs.json"), []byte(`[{"request": {"method": "GET", "urlPath": "/file"}, "response": {"body": "from file"}}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(Options{
+		Dir: dir,
+		Endpoints: []Endpoint{
+			{
+				Request:  Request{Method: "GET", URLPathTemplate: "/greet/{name}", PathParameters: map[string]Matcher{"name": {Matches: "^[a-z]+$"}}},
+				Response: Response{Body: "hello {{.Path.name}}"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "endpoint", path: "/greet/gopher", wantStatus: 200, wantBody: "hello gopher"},
+		{name: "file", path: "/file", wantStatus: 200, wantBody: "from file"},
+		{name: "unmatched", path: "/greet/Gopher", wantStatus: 404, wantBody: "404 page not found"},
+		{name: "admin", path: "/__admin/stubs/endpoints%230", wantStatus: 200, wantBody: `"id":"endpoints#0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := get(tt.path)
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("GET %s = %d %q, want %d with %q", tt.path, status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	if _, err := server.AddStub(Endpoint{
+		Request:  Request{Method: "GET", URLPath: "/greet/gopher"},
+		Response: Response{Status: 503},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get("/greet/gopher"); status != 503 {
+		t.Errorf("status after AddStub = %d, want 503", status)
+	}
+
+	one := 1
+	result, err := server.Verify(Verification{Request: Request{URLPath: "/greet/gopher"}, Exactly: &one})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 2 || result.Err() == nil {
+		t.Errorf("Verify() = %d requests, err %v; want 2 and a failure", result.Count, result.Err())
+	}
+	// requests to the admin API are not journaled
+	if got := len(server.Requests()); got != 4 {
+		t.Errorf("journaled %d requests, want 4", got)
+	}
+
+	server.Reset()
+	if status, _ := get("/greet/gopher"); status != 200 {
+		t.Errorf("status after Reset = %d, want 200", status)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("journaled %d requests after Reset, want 1", got)
+	}
+}
+
+func Test_ServerSeparateAdmin(t *testing.T) {
+	server, err := NewServer(Options{SeparateAdmin: true, AdminToken: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__admin/stubs", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("admin on the stub handler = %d, want 404", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/__admin/stubs", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	rec = httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("AdminHandler() = %d, want 200", rec.Code)
+	}
+}
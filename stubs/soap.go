@@ -0,0 +1,245 @@
+package stubs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SOAPRequest matches a SOAP 1.1 or 1.2 call on its action and operation element.
+type SOAPRequest struct {
+	Action    string `json:"action,omitempty"`    // SOAPAction ヘッダー (SOAP 1.2 では Content-Type の action パラメータ)
+	Operation string `json:"operation,omitempty"` // Body 直下の要素のローカル名
+	Namespace string `json:"namespace,omitempty"` // Body 直下の要素の名前空間
+	Version   string `json:"version,omitempty"`   // 1.1 または 1.2。省略時はどちらにも一致する
+}
+
+// SOAPResponse answers with a SOAP fault instead of the body.
+type SOAPResponse struct {
+	Fault *SOAPFault `json:"fault,omitempty"`
+}
+type SOAPFault struct {
+	Code   string `json:"code,omitempty"`   // Client/Server (1.1) または Sender/Receiver (1.2)。バージョンに合わせて変換される
+	String string `json:"string,omitempty"` // faultstring (1.1) / Reason (1.2)
+	Actor  string `json:"actor,omitempty"`  // faultactor (1.1) / Role (1.2)
+	Detail string `json:"detail,omitempty"` // detail 要素の中身 (XML)
+}
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// parseSOAPEnvelope returns the SOAP version of the envelope and the name of the
+// first element of its Body.
+func parseSOAPEnvelope(body []byte) (string, xml.Name, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	version := ""
+	inBody := false
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return "", xml.Name{}, errors.New("SOAP body is empty")
+		}
+		if err != nil {
+			return "", xml.Name{}, err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch {
+		case version == "":
+			if start.Name.Local != "Envelope" {
+				return "", xml.Name{}, errors.New("not a SOAP envelope")
+			}
+			switch start.Name.Space {
+			case soap11Namespace:
+				version = "1.1"
+			case soap12Namespace:
+				version = "1.2"
+			default:
+				return "", xml.Name{}, errors.New("unknown SOAP envelope namespace")
+			}
+		case !inBody:
+			if start.Name.Local == "Body" {
+				inBody = true
+			} else if err := d.Skip(); err != nil {
+				return "", xml.Name{}, err
+			}
+		default:
+			return version, start.Name, nil
+		}
+	}
+}
+
+func isSOAPEnvelope(body string) bool {
+	d := xml.NewDecoder(strings.NewReader(body))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := t.(xml.StartElement); ok {
+			return start.Name.Local == "Envelope" && (start.Name.Space == soap11Namespace || start.Name.Space == soap12Namespace)
+		}
+	}
+}
+
+// soapAction returns the action of a SOAP 1.1 (SOAPAction header) or 1.2
+// (action parameter of the Content-Type) request.
+func soapAction(header http.Header) string {
+	if action := header.Get("SOAPAction"); action != "" {
+		return strings.Trim(action, `"`)
+	}
+	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["action"]
+}
+
+func soapMatcher(endpoint Endpoint, header http.Header, body string) bool {
+	s := endpoint.Request.SOAP
+	if s == nil {
+		return true
+	}
+	version, operation, err := parseSOAPEnvelope([]byte(body))
+	if err != nil {
+		return false
+	}
+	if s.Version != "" && s.Version != version {
+		return false
+	}
+	if s.Action != "" && s.Action != soapAction(header) {
+		return false
+	}
+	if s.Operation != "" && s.Operation != operation.Local {
+		return false
+	}
+	if s.Namespace != "" && s.Namespace != operation.Space {
+		return false
+	}
+	return true
+}
+
+func soapContentType(version string) string {
+	if version == "1.2" {
+		return "application/soap+xml; charset=utf-8"
+	}
+	return "text/xml; charset=utf-8"
+}
+
+// soapResponseBody wraps the response body, or the configured fault, into an
+// envelope of the given version. Bodies that already are an envelope are kept.
+func soapResponseBody(version string, response Response, body string) (string, error) {
+	namespace := soap11Namespace
+	if version == "1.2" {
+		namespace = soap12Namespace
+	}
+	var content string
+	switch {
+	case response.SOAP != nil && response.SOAP.Fault != nil:
+		fault, err := soapFaultXML(version, *response.SOAP.Fault)
+		if err != nil {
+			return "", err
+		}
+		content = fault
+	default:
+		if isSOAPEnvelope(body) {
+			return body, nil
+		}
+		content = body
+	}
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<soap:Envelope xmlns:soap="` + namespace + `">`)
+	sb.WriteString(`<soap:Body>`)
+	sb.WriteString(content)
+	sb.WriteString(`</soap:Body>`)
+	sb.WriteString(`</soap:Envelope>`)
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func soapFaultXML(version string, fault SOAPFault) (string, error) {
+	escape := func(s string) (string, error) {
+		var b strings.Builder
+		if err := xml.EscapeText(&b, []byte(s)); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+	code, err := escape(soapFaultCode(version, fault.Code))
+	if err != nil {
+		return "", err
+	}
+	reason, err := escape(fault.String)
+	if err != nil {
+		return "", err
+	}
+	actor, err := escape(fault.Actor)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<soap:Fault>`)
+	if version == "1.2" {
+		sb.WriteString(`<soap:Code><soap:Value>soap:` + code + `</soap:Value></soap:Code>`)
+		sb.WriteString(`<soap:Reason><soap:Text xml:lang="en">` + reason + `</soap:Text></soap:Reason>`)
+		if fault.Actor != "" {
+			sb.WriteString(`<soap:Role>` + actor + `</soap:Role>`)
+		}
+		if fault.Detail != "" {
+			sb.WriteString(`<soap:Detail>` + fault.Detail + `</soap:Detail>`)
+		}
+	} else {
+		sb.WriteString(`<faultcode>soap:` + code + `</faultcode>`)
+		sb.WriteString(`<faultstring>` + reason + `</faultstring>`)
+		if fault.Actor != "" {
+			sb.WriteString(`<faultactor>` + actor + `</faultactor>`)
+		}
+		if fault.Detail != "" {
+			sb.WriteString(`<detail>` + fault.Detail + `</detail>`)
+		}
+	}
+	sb.WriteString(`</soap:Fault>`)
+	return sb.String(), nil
+}
+
+// soapFaultCode translates fault codes between the SOAP 1.1 and 1.2 vocabularies.
+func soapFaultCode(version, code string) string {
+	code = code[strings.LastIndex(code, ":")+1:]
+	if code == "" {
+		code = "Server"
+	}
+	soap11 := map[string]string{"Sender": "Client", "Receiver": "Server"}
+	soap12 := map[string]string{"Client": "Sender", "Server": "Receiver"}
+	if version == "1.2" {
+		if c, ok := soap12[code]; ok {
+			return c
+		}
+		return code
+	}
+	if c, ok := soap11[code]; ok {
+		return c
+	}
+	return code
+}
+
+// soapResponseVersion answers in the version of the request envelope, falling
+// back to the stub's version and then to SOAP 1.1.
+func soapResponseVersion(endpoint Endpoint, body []byte) string {
+	if version, _, err := parseSOAPEnvelope(body); err == nil {
+		return version
+	}
+	if endpoint.Request.SOAP != nil && endpoint.Request.SOAP.Version != "" {
+		return endpoint.Request.SOAP.Version
+	}
+	return "1.1"
+}
@@ -0,0 +1,195 @@
+package stubs
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	soap11Envelope = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><auth>token</auth></soap:Header>
+  <soap:Body>
+    <q:GetQuote xmlns:q="urn:quotes"><symbol>ACME</symbol></q:GetQuote>
+  </soap:Body>
+</soap:Envelope>`
+	soap12Envelope = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body><q:GetQuote xmlns:q="urn:quotes"/></env:Body>
+</env:Envelope>`
+)
+
+func Test_soapMatcher(t *testing.T) {
+	type args struct {
+		soap   *SOAPRequest
+		header http.Header
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "no soap section",
+			args: args{body: "plain"},
+			want: true,
+		},
+		{
+			name: "soap 1.1",
+			args: args{
+				soap:   &SOAPRequest{Action: "urn:GetQuote", Operation: "GetQuote", Namespace: "urn:quotes", Version: "1.1"},
+				header: http.Header{"Soapaction": []string{`"urn:GetQuote"`}},
+				body:   soap11Envelope,
+			},
+			want: true,
+		},
+		{
+			name: "soap 1.2 action in content type",
+			args: args{
+				soap:   &SOAPRequest{Action: "urn:GetQuote", Operation: "GetQuote", Version: "1.2"},
+				header: http.Header{"Content-Type": []string{`application/soap+xml; charset=utf-8; action="urn:GetQuote"`}},
+				body:   soap12Envelope,
+			},
+			want: true,
+		},
+		{
+			name: "action false",
+			args: args{
+				soap:   &SOAPRequest{Action: "urn:GetQuote"},
+				header: http.Header{"Soapaction": []string{`"urn:Other"`}},
+				body:   soap11Envelope,
+			},
+			want: false,
+		},
+		{
+			name: "operation false",
+			args: args{
+				soap: &SOAPRequest{Operation: "PlaceOrder"},
+				body: soap11Envelope,
+			},
+			want: false,
+		},
+		{
+			name: "version false",
+			args: args{
+				soap: &SOAPRequest{Version: "1.2"},
+				body: soap11Envelope,
+			},
+			want: false,
+		},
+		{
+			name: "not an envelope",
+			args: args{
+				soap: &SOAPRequest{},
+				body: `<GetQuote/>`,
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := Endpoint{Request: Request{SOAP: tt.args.soap}}
+			if got := soapMatcher(endpoint, tt.args.header, tt.args.body); got != tt.want {
+				t.Errorf("soapMatcher() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_soapResponseBody(t *testing.T) {
+	fault := &SOAPResponse{Fault: &SOAPFault{Code: "Client", String: "Invalid <symbol>", Detail: "<code>42</code>"}}
+	tests := []struct {
+		name     string
+		version  string
+		response Response
+		body     string
+		want     string
+	}{
+		{
+			name:    "wrap body",
+			version: "1.1",
+			body:    `<GetQuoteResponse>1</GetQuoteResponse>`,
+			want: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetQuoteResponse>1</GetQuoteResponse></soap:Body></soap:Envelope>` + "\n",
+		},
+		{
+			name:    "keep envelope",
+			version: "1.2",
+			body:    soap12Envelope,
+			want:    soap12Envelope,
+		},
+		{
+			name:     "soap 1.1 fault",
+			version:  "1.1",
+			response: Response{SOAP: fault},
+			want: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+				`<faultcode>soap:Client</faultcode><faultstring>Invalid &lt;symbol&gt;</faultstring><detail><code>42</code></detail>` +
+				`</soap:Fault></soap:Body></soap:Envelope>` + "\n",
+		},
+		{
+			name:     "soap 1.2 fault",
+			version:  "1.2",
+			response: Response{SOAP: fault},
+			want: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body><soap:Fault>` +
+				`<soap:Code><soap:Value>soap:Sender</soap:Value></soap:Code><soap:Reason><soap:Text xml:lang="en">Invalid &lt;symbol&gt;</soap:Text></soap:Reason><soap:Detail><code>42</code></soap:Detail>` +
+				`</soap:Fault></soap:Body></soap:Envelope>` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := soapResponseBody(tt.version, tt.response, tt.body)
+			if err != nil {
+				t.Fatalf("soapResponseBody() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("diff: %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func Test_wsdlEndpoints(t *testing.T) {
+	b, err := os.ReadFile("testdata/stockquote.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := WSDLEndpoints(b)
+	if err != nil {
+		t.Fatalf("wsdlEndpoints() error = %v", err)
+	}
+	wantRequests := []Request{
+		{
+			URLPath: "/stockquote",
+			Method:  "POST",
+			SOAP:    &SOAPRequest{Action: "http://example.com/GetLastTradePrice", Operation: "TradePriceRequest", Namespace: "http://example.com/stockquote.xsd", Version: "1.1"},
+		},
+		{
+			URLPath: "/stockquote12",
+			Method:  "POST",
+			SOAP:    &SOAPRequest{Action: "http://example.com/GetLastTradePrice", Operation: "TradePriceRequest", Namespace: "http://example.com/stockquote.xsd", Version: "1.2"},
+		},
+	}
+	var gotRequests []Request
+	for _, endpoint := range got {
+		gotRequests = append(gotRequests, endpoint.Request)
+	}
+	if !cmp.Equal(gotRequests, wantRequests) {
+		t.Errorf("diff: %v", cmp.Diff(gotRequests, wantRequests))
+	}
+	wantSample := `<tns:TradePrice xmlns:tns="http://example.com/stockquote.xsd">
+  <tns:price>0.0</tns:price>
+  <tns:currency>USD</tns:currency>
+  <tns:updated>2000-01-01T00:00:00Z</tns:updated>
+</tns:TradePrice>`
+	for _, endpoint := range got {
+		if !strings.Contains(endpoint.Response.Body, wantSample) {
+			t.Errorf("response body %q does not contain sample %q", endpoint.Response.Body, wantSample)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package stubs answers HTTP, GraphQL, gRPC, JSON-RPC and SOAP requests from
+// stubs written in the Endpoint JSON format.
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// define the structure of the JSON configuration file
+type Matcher struct {
+	EqualTo        any `json:"equalTo,omitempty"`
+	Matches        any `json:"matches,omitempty"`
+	DoesNotMatch   any `json:"doesNotMatch,omitempty"`
+	Contains       any `json:"contains,omitempty"`
+	DoesNotContain any `json:"doesNotContain,omitempty"`
+}
+type Request struct {
+	URL             string `json:"url,omitempty"`             // パスパラメータ、クエリパラメータを含む完全一致
+	URLPattern      string `json:"urlPattern,omitempty"`      // パスパラメータ、クエリパラメータを含む正規表現での完全一致
+	URLPath         string `json:"urlPath,omitempty"`         // パスパラメータを含む完全一致
+	URLPathPattern  string `json:"urlPathPattern,omitempty"`  // パスパラメータを含む正規表現での完全一致
+	URLPathTemplate string `json:"urlPathTemplate,omitempty"` // パスパラメータを含むテンプレートでの完全一致
+
+	Method          string             `json:"method,omitempty"`
+	QueryParameters map[string]Matcher `json:"queryParameters,omitempty"`
+	PathParameters  map[string]Matcher `json:"pathParameters,omitempty"`
+	Body            Matcher            `json:"body,omitzero"`
+	Auth            *Auth              `json:"auth,omitempty"`
+	GraphQL         *GraphQLRequest    `json:"graphql,omitempty"`
+	GRPC            *GRPCRequest       `json:"grpc,omitempty"`
+	JSONRPC         *JSONRPCRequest    `json:"jsonrpc,omitempty"`
+	SOAP            *SOAPRequest       `json:"soap,omitempty"`
+}
+type Response struct {
+	Status                 int                        `json:"status,omitempty"`
+	BodyFileName           string                     `json:"bodyFileName,omitempty"`           // bodyFileNameが指定されている場合は、bodyは無視される
+	Body                   string                     `json:"body,omitempty"`                   // bodyFileNameが指定されていない場合は、bodyを使用する
+	Headers                map[string]HeaderValues    `json:"headers,omitempty"`                // テンプレートとして展開される。複数値は配列で指定する
+	FixedDelayMilliseconds int                        `json:"fixedDelayMilliseconds,omitempty"` // 応答を遅らせる時間 (ミリ秒)
+	DelayDistribution      *DelayDistribution         `json:"delayDistribution,omitempty"`      // ランダムな遅延。fixedDelayMilliseconds に加算される
+	ChunkedDribbleDelay    *ChunkedDribbleDelay       `json:"chunkedDribbleDelay,omitempty"`    // ボディを分割して少しずつ送る
+	BytesPerSecond         int                        `json:"bytesPerSecond,omitempty"`         // ボディを送る速さの上限 (バイト/秒)
+	ProxyBaseURL           string                     `json:"proxyBaseUrl,omitempty"`           // 指定されている場合は、このURLにリクエストを転送してそのレスポンスを返す
+	Proxy                  *ProxyOptions              `json:"proxy,omitempty"`
+	Dataset                *Dataset                   `json:"dataset,omitempty"`               // 指定されている場合は、データセットのファイルから一覧または 1 件を返す
+	Fault                  string                     `json:"fault,omitempty"`                 // 接続を壊す障害 (CONNECTION_RESET_BY_PEER, EMPTY_RESPONSE, RANDOM_DATA_THEN_CLOSE, TRUNCATED_BODY, MALFORMED_RESPONSE_CHUNK, HANG)
+	Transformaers          []string                   `json:"transformers,omitempty"`          // 順に適用するトランスフォーマー。省略時は template のみ
+	TransformerParameters  map[string]json.RawMessage `json:"transformerParameters,omitempty"` // トランスフォーマー名ごとのパラメータ
+	GraphQLErrors          []GraphQLError             `json:"graphqlErrors,omitempty"`         // 指定されている場合は GraphQL の errors 形式で返す
+	GRPC                   *GRPCResponse              `json:"grpc,omitempty"`
+	JSONRPC                *JSONRPCResponse           `json:"jsonrpc,omitempty"`
+	SOAP                   *SOAPResponse              `json:"soap,omitempty"`
+}
+type Endpoint struct {
+	ID                    string             `json:"id,omitempty"` // 省略時は "ファイルのパス#添字"
+	Request               Request            `json:"request"`
+	Response              Response           `json:"response"`
+	Responses             []Response         `json:"responses,omitempty"`   // 指定されている場合は、呼ばれるたびに順に返す
+	SequenceEnd           string             `json:"sequenceEnd,omitempty"` // responses を返し終えた後の動作 (repeatLast, cycle, fallThrough)
+	ScenarioName          string             `json:"scenarioName,omitempty"`
+	RequiredScenarioState string             `json:"requiredScenarioState,omitempty"` // シナリオがこの状態のときだけ一致する
+	NewScenarioState      string             `json:"newScenarioState,omitempty"`      // 応答した後のシナリオの状態
+	Resource              *Resource          `json:"resource,omitempty"`              // 指定されている場合は request/response の代わりにインメモリの CRUD を提供する
+	RandomResponses       []WeightedResponse `json:"randomResponses,omitempty"`       // 指定されている場合は、重みに応じてランダムに選んで返す
+}
+
+// TemplateData is the request data passed to response templates and transformers.
+type TemplateData struct {
+	Path  map[string]string
+	Query map[string]string
+	Body  string // リクエストボディ
+	JSON  any    // JSON としてパースしたリクエストボディ。JSON でない場合は空のオブジェクト
+}
+
+func pathMatcher(endpoint Endpoint, gotRawPath, gotPath string) (bool, map[string]string) {
+	// trim trailing slashes
+	gotPath = strings.TrimRight(gotPath, "/")
+	gotRawPath = strings.TrimRight(gotRawPath, "/")
+
+	var url string
+	switch {
+	case endpoint.Request.URL != "":
+		url = strings.TrimRight(endpoint.Request.URL, "/")
+		if gotRawPath != url {
+			return false, nil
+		}
+		return true, nil
+	case endpoint.Request.URLPattern != "":
+		url = strings.TrimRight(endpoint.Request.URLPattern, "/")
+		if !regexp.MustCompile(url).MatchString(gotRawPath) {
+			return false, nil
+		}
+		return true, nil
+	case endpoint.Request.URLPath != "":
+		url = strings.TrimRight(endpoint.Request.URLPath, "/")
+		if gotPath != url {
+			return false, nil
+		}
+		return true, nil
+	case endpoint.Request.URLPathPattern != "":
+		url = strings.TrimRight(endpoint.Request.URLPathPattern, "/")
+		if !regexp.MustCompile(url).MatchString(gotPath) {
+			return false, nil
+		}
+		return true, nil
+	case endpoint.Request.URLPathTemplate != "":
+		url = strings.TrimRight(endpoint.Request.URLPathTemplate, "/")
+	default:
+		return false, nil
+	}
+
+	// check if the path parameters match
+	requredPathUnits := strings.Split(url, "/")
+	gotPathUnits := strings.Split(gotPath, "/")
+	if len(requredPathUnits) != len(gotPathUnits) {
+		return false, nil
+	}
+
+	// placeholder->position
+	posMap := make(map[string]int)
+	for k := range endpoint.Request.PathParameters {
+		placeHolder := fmt.Sprintf("{%s}", k)
+		if i := slices.Index(requredPathUnits, placeHolder); i == -1 {
+			slog.Error(fmt.Sprintf("Path parameter %s not found in path %s", k, gotPath))
+			return false, nil
+		} else {
+			posMap[k] = i
+		}
+	}
+
+	for k, v := range endpoint.Request.PathParameters {
+		if !valueMatcher(v, gotPathUnits[posMap[k]]) {
+			return false, nil
+		}
+	}
+	ret := make(map[string]string)
+	for k, v := range posMap {
+		ret[k] = gotPathUnits[v]
+	}
+	return true, ret
+}
+
+func queryMatcher(endpoint Endpoint, gotQuery url.Values) bool {
+	for k, v := range endpoint.Request.QueryParameters {
+		if !valueMatcher(v, gotQuery.Get(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+func bodyMatcher(endpoint Endpoint, body string) bool {
+	return valueMatcher(endpoint.Request.Body, body)
+}
+
+// valueMatcher reports whether got satisfies every rule set in the matcher.
+func valueMatcher(m Matcher, got string) bool {
+	if m.EqualTo != nil {
+		if got != fmt.Sprint(m.EqualTo) {
+			return false
+		}
+	}
+	if m.Matches != nil {
+		if !regexp.MustCompile(fmt.Sprint(m.Matches)).MatchString(got) {
+			return false
+		}
+	}
+	if m.DoesNotMatch != nil {
+		if regexp.MustCompile(fmt.Sprint(m.DoesNotMatch)).MatchString(got) {
+			return false
+		}
+	}
+	if m.Contains != nil {
+		if !strings.Contains(got, fmt.Sprint(m.Contains)) {
+			return false
+		}
+	}
+	if m.DoesNotContain != nil {
+		if strings.Contains(got, fmt.Sprint(m.DoesNotContain)) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueString converts a decoded JSON value into the string matchers are applied to.
+func valueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lookupPath resolves a key of a decoded JSON object by its literal name first,
+// then as a dot separated path.
+func lookupPath(obj map[string]any, name string) (any, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	var current any = obj
+	for _, key := range strings.Split(name, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// renderBody runs the response body through the transformers. bodyFileNameが指定されている場合は、bodyは無視される
+func renderBody(response Response, gp TemplateData) (string, error) {
+	responseBody, err := bodySource(response)
+	if err != nil {
+		return "", err
+	}
+	tr := &TransformedResponse{Status: response.Status, Header: http.Header{}, Body: []byte(responseBody), Data: gp}
+	if err := transform(response, tr); err != nil {
+		return "", err
+	}
+	return string(tr.Body), nil
+}
+
+// bodySource returns the untransformed response body.
+func bodySource(response Response) (string, error) {
+	if response.BodyFileName == "" {
+		return response.Body, nil
+	}
+	b, err := os.ReadFile(response.BodyFileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read body file: %w", err)
+	}
+	return string(b), nil
+}
+
+func renderTemplate(text string, gp TemplateData) (string, error) {
+	tpl, err := template.New("response").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse response template: %w", err)
+	}
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, gp); err != nil {
+		return "", fmt.Errorf("failed to execute response template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func loadConfig(dir string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		byteValue, _ := io.ReadAll(file)
+		var fileEndpoints []Endpoint
+		err = json.Unmarshal(byteValue, &fileEndpoints)
+		if err != nil {
+			return err
+		}
+		for i := range fileEndpoints {
+			if fileEndpoints[i].ID == "" {
+				fileEndpoints[i].ID = fmt.Sprintf("%s#%d", filepath.ToSlash(path), i)
+			}
+			if err := validateEndpoint(fileEndpoints[i]); err != nil {
+				return fmt.Errorf("invalid stub %s: %w", fileEndpoints[i].ID, err)
+			}
+		}
+		endpoints = append(endpoints, fileEndpoints...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
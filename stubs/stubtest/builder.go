@@ -0,0 +1,175 @@
+package stubtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dev-shimada/api-stubs/stubs"
+)
+
+// Builder builds a stub, or the request pattern of a verification, one call at
+// a time. Start one with Get, Post, Put, Patch, Delete, Any or Request.
+type Builder struct {
+	endpoint stubs.Endpoint
+	err      error
+}
+
+// Request starts a stub for method and path. A path with {name} segments is a
+// template and any other path is matched exactly. A query string adds an
+// equalTo matcher per parameter; other parameters are allowed.
+func Request(method, path string) *Builder {
+	b := &Builder{endpoint: stubs.Endpoint{Request: stubs.Request{Method: method}}}
+	path, rawQuery, hasQuery := strings.Cut(path, "?")
+	if strings.Contains(path, "{") {
+		b.endpoint.Request.URLPathTemplate = path
+	} else {
+		b.endpoint.Request.URLPath = path
+	}
+	if hasQuery {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		for name := range query {
+			b.WithQueryParam(name, EqualTo(query.Get(name)))
+		}
+	}
+	return b
+}
+
+func Get(path string) *Builder    { return Request(http.MethodGet, path) }
+func Post(path string) *Builder   { return Request(http.MethodPost, path) }
+func Put(path string) *Builder    { return Request(http.MethodPut, path) }
+func Patch(path string) *Builder  { return Request(http.MethodPatch, path) }
+func Delete(path string) *Builder { return Request(http.MethodDelete, path) }
+
+// Any matches requests of any method. It is meant for Verify, as stubs only
+// match the method they name.
+func Any(path string) *Builder { return Request("", path) }
+
+// Matchers for path and query parameters and bodies.
+func EqualTo(v any) stubs.Matcher           { return stubs.Matcher{EqualTo: v} }
+func Matches(re string) stubs.Matcher       { return stubs.Matcher{Matches: re} }
+func DoesNotMatch(re string) stubs.Matcher  { return stubs.Matcher{DoesNotMatch: re} }
+func Contains(s string) stubs.Matcher       { return stubs.Matcher{Contains: s} }
+func DoesNotContain(s string) stubs.Matcher { return stubs.Matcher{DoesNotContain: s} }
+
+// WithID sets the stub's ID. Stubs without one get a UUID.
+func (b *Builder) WithID(id string) *Builder {
+	b.endpoint.ID = id
+	return b
+}
+
+func (b *Builder) WithPathParam(name string, m stubs.Matcher) *Builder {
+	if b.endpoint.Request.PathParameters == nil {
+		b.endpoint.Request.PathParameters = make(map[string]stubs.Matcher)
+	}
+	b.endpoint.Request.PathParameters[name] = m
+	return b
+}
+
+func (b *Builder) WithQueryParam(name string, m stubs.Matcher) *Builder {
+	if b.endpoint.Request.QueryParameters == nil {
+		b.endpoint.Request.QueryParameters = make(map[string]stubs.Matcher)
+	}
+	b.endpoint.Request.QueryParameters[name] = m
+	return b
+}
+
+func (b *Builder) WithBody(m stubs.Matcher) *Builder {
+	b.endpoint.Request.Body = m
+	return b
+}
+
+func (b *Builder) WithBearer(token string) *Builder {
+	b.endpoint.Request.Auth = &stubs.Auth{Bearer: token}
+	return b
+}
+
+func (b *Builder) WithBasicAuth(username, password string) *Builder {
+	b.endpoint.Request.Auth = &stubs.Auth{Basic: &stubs.BasicAuth{Username: username, Password: password}}
+	return b
+}
+
+// InScenario makes the stub part of a scenario. It only matches while the
+// scenario is in state, or in any state when state is empty, and moves the
+// scenario to newState once served unless newState is empty.
+func (b *Builder) InScenario(name, state, newState string) *Builder {
+	b.endpoint.ScenarioName = name
+	b.endpoint.RequiredScenarioState = state
+	b.endpoint.NewScenarioState = newState
+	return b
+}
+
+// Reply sets the response status.
+func (b *Builder) Reply(status int) *Builder {
+	b.endpoint.Response.Status = status
+	return b
+}
+
+// Body sets the response body. It is a template unless transformers say otherwise.
+func (b *Builder) Body(body string) *Builder {
+	b.endpoint.Response.Body = body
+	return b
+}
+
+// JSONBody sets the response body to v encoded as JSON, with a Content-Type
+// of application/json unless one was set. JSON escapes the quotes inside
+// template actions, so templates belong in Body.
+func (b *Builder) JSONBody(v any) *Builder {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		b.err = err
+		return b
+	}
+	b.endpoint.Response.Body = strings.TrimSuffix(sb.String(), "\n")
+	for name := range b.endpoint.Response.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			return b
+		}
+	}
+	return b.Header("Content-Type", "application/json")
+}
+
+// BodyFile answers with the file at name instead of a body.
+func (b *Builder) BodyFile(name string) *Builder {
+	b.endpoint.Response.BodyFileName = name
+	return b
+}
+
+// Header sets a response header. Values are templates.
+func (b *Builder) Header(name string, values ...string) *Builder {
+	if b.endpoint.Response.Headers == nil {
+		b.endpoint.Response.Headers = make(map[string]stubs.HeaderValues)
+	}
+	b.endpoint.Response.Headers[name] = values
+	return b
+}
+
+func (b *Builder) Delay(d time.Duration) *Builder {
+	b.endpoint.Response.FixedDelayMilliseconds = int(d.Milliseconds())
+	return b
+}
+
+// Transformers sets the transformers applied to the response, in order.
+func (b *Builder) Transformers(names ...string) *Builder {
+	b.endpoint.Response.Transformaers = names
+	return b
+}
+
+// Fault breaks the connection instead of answering, e.g. CONNECTION_RESET_BY_PEER.
+func (b *Builder) Fault(fault string) *Builder {
+	b.endpoint.Response.Fault = fault
+	return b
+}
+
+// Endpoint returns the stub built so far.
+func (b *Builder) Endpoint() (stubs.Endpoint, error) {
+	return b.endpoint, b.err
+}
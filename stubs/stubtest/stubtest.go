@@ -0,0 +1,114 @@
+// Package stubtest runs a stub server for Go tests.
+//
+//	s := stubtest.New(t)
+//	s.Stub(stubtest.Get("/users/{id}").
+//		WithPathParam("id", stubtest.Matches(`^\d+$`)).
+//		Reply(200).
+//		Header("Content-Type", "application/json").
+//		Body(`{"id": "{{.Path.id}}"}`))
+//	client := NewClient(s.URL)
+//	...
+//	s.Verify(stubtest.Get("/users/{id}"), stubtest.Exactly(1))
+package stubtest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/api-stubs/stubs"
+)
+
+// Server is a stub server listening on a local port for the length of a test.
+type Server struct {
+	*httptest.Server
+	Stubs *stubs.Server
+
+	t testing.TB
+}
+
+// New starts a stub server without stubs. It is closed when the test ends.
+func New(t testing.TB) *Server {
+	t.Helper()
+	return NewWithOptions(t, stubs.Options{})
+}
+
+// NewWithOptions starts a stub server configured by opts. It is closed when
+// the test ends.
+func NewWithOptions(t testing.TB, opts stubs.Options) *Server {
+	t.Helper()
+	server, err := stubs.NewServer(opts)
+	if err != nil {
+		t.Fatalf("Failed to create stub server: %s", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		if err := server.Close(); err != nil {
+			t.Errorf("Failed to close stub server: %s", err)
+		}
+	})
+	return &Server{Server: ts, Stubs: server, t: t}
+}
+
+// Stub adds the stub built by b in front of the others, so the last stub
+// added for a request wins. It returns the stub with its ID.
+func (s *Server) Stub(b *Builder) stubs.Endpoint {
+	s.t.Helper()
+	endpoint, err := b.Endpoint()
+	if err != nil {
+		s.t.Fatalf("Invalid stub: %s", err)
+	}
+	endpoint, err = s.Stubs.AddStub(endpoint)
+	if err != nil {
+		s.t.Fatalf("Failed to add stub: %s", err)
+	}
+	return endpoint
+}
+
+// Count is the number of requests a verification expects.
+type Count func(*stubs.Verification)
+
+func Exactly(n int) Count { return func(v *stubs.Verification) { v.Exactly = &n } }
+func AtLeast(n int) Count { return func(v *stubs.Verification) { v.AtLeast = &n } }
+func AtMost(n int) Count  { return func(v *stubs.Verification) { v.AtMost = &n } }
+func Never() Count        { return Exactly(0) }
+
+// Verify fails the test unless the server received the number of requests
+// matching the request of b given by counts, or at least one when counts are
+// left out. The failure lists the requests that came closest.
+func (s *Server) Verify(b *Builder, counts ...Count) {
+	s.t.Helper()
+	endpoint, err := b.Endpoint()
+	if err != nil {
+		s.t.Fatalf("Invalid verification: %s", err)
+	}
+	v := stubs.Verification{Request: endpoint.Request}
+	if len(counts) == 0 {
+		counts = []Count{AtLeast(1)}
+	}
+	for _, count := range counts {
+		count(&v)
+	}
+	result, err := s.Stubs.Verify(v)
+	if err != nil {
+		s.t.Fatalf("Invalid verification: %s", err)
+	}
+	if result.Failure != nil {
+		s.t.Error(formatFailure(result.Failure))
+	}
+}
+
+// formatFailure writes the failure message followed by a diff of each near miss.
+func formatFailure(f *stubs.VerificationFailure) string {
+	var sb strings.Builder
+	sb.WriteString(f.Message)
+	for _, miss := range f.NearMisses {
+		fmt.Fprintf(&sb, "\nnear miss: %s %s", miss.Request.Method, miss.Request.URL)
+		for _, m := range miss.Mismatches {
+			fmt.Fprintf(&sb, "\n  %s (-want +got):\n    - %s\n    + %s", m.Field, m.Expected, m.Actual)
+		}
+	}
+	return sb.String()
+}
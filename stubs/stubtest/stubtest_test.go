@@ -0,0 +1,247 @@
+package stubtest_test
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/api-stubs/stubs"
+	"github.com/dev-shimada/api-stubs/stubs/stubtest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Builder(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *stubtest.Builder
+		want    stubs.Endpoint
+		wantErr bool
+	}{
+		{
+			name: "template",
+			builder: stubtest.Get("/users/{id}").
+				WithPathParam("id", stubtest.Matches(`^\d+$`)).
+				Reply(200).
+				Body(`{"id": "{{.Path.id}}"}`),
+			want: stubs.Endpoint{
+				Request: stubs.Request{
+					Method:          "GET",
+					URLPathTemplate: "/users/{id}",
+					PathParameters:  map[string]stubs.Matcher{"id": {Matches: `^\d+$`}},
+				},
+				Response: stubs.Response{Status: 200, Body: `{"id": "{{.Path.id}}"}`},
+			},
+		},
+		{
+			name:    "json body without html escaping",
+			builder: stubtest.Get("/page").JSONBody(map[string]string{"html": "<b>Tom & Jerry</b>"}),
+			want: stubs.Endpoint{
+				Request: stubs.Request{Method: "GET", URLPath: "/page"},
+				Response: stubs.Response{
+					Body:    `{"html":"<b>Tom & Jerry</b>"}`,
+					Headers: map[string]stubs.HeaderValues{"Content-Type": {"application/json"}},
+				},
+			},
+		},
+		{
+			name:    "json body keeps a content type in any case",
+			builder: stubtest.Get("/problem").Header("content-type", "application/problem+json").JSONBody(map[string]int{"status": 400}),
+			want: stubs.Endpoint{
+				Request: stubs.Request{Method: "GET", URLPath: "/problem"},
+				Response: stubs.Response{
+					Body:    `{"status":400}`,
+					Headers: map[string]stubs.HeaderValues{"content-type": {"application/problem+json"}},
+				},
+			},
+		},
+		{
+			name: "request matchers",
+			builder: stubtest.Post("/payments").
+				WithID("pay").
+				WithQueryParam("currency", stubtest.EqualTo("JPY")).
+				WithBody(stubtest.Contains(`"amount"`)).
+				WithBearer("secret").
+				InScenario("checkout", "Started", "Paid"),
+			want: stubs.Endpoint{
+				ID: "pay",
+				Request: stubs.Request{
+					Method:          "POST",
+					URLPath:         "/payments",
+					QueryParameters: map[string]stubs.Matcher{"currency": {EqualTo: "JPY"}},
+					Body:            stubs.Matcher{Contains: `"amount"`},
+					Auth:            &stubs.Auth{Bearer: "secret"},
+				},
+				ScenarioName:          "checkout",
+				RequiredScenarioState: "Started",
+				NewScenarioState:      "Paid",
+			},
+		},
+		{
+			name: "query string with response options",
+			builder: stubtest.Put("/search?q=go").
+				Reply(503).
+				Header("Retry-After", "1").
+				JSONBody([]int{1}).
+				Delay(150 * time.Millisecond).
+				Transformers("none"),
+			want: stubs.Endpoint{
+				Request: stubs.Request{Method: "PUT", URLPath: "/search", QueryParameters: map[string]stubs.Matcher{"q": {EqualTo: "go"}}},
+				Response: stubs.Response{
+					Status:                 503,
+					Body:                   "[1]",
+					Headers:                map[string]stubs.HeaderValues{"Retry-After": {"1"}, "Content-Type": {"application/json"}},
+					FixedDelayMilliseconds: 150,
+					Transformaers:          []string{"none"},
+				},
+			},
+		},
+		{
+			name:    "invalid query string",
+			builder: stubtest.Get("/search?q=%zz"),
+			wantErr: true,
+		},
+		{
+			name:    "unencodable json body",
+			builder: stubtest.Get("/").JSONBody(func() {}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Endpoint()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Endpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Endpoint() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_Server(t *testing.T) {
+	s := stubtest.New(t)
+	s.Stub(stubtest.Get("/users/{id}").
+		WithPathParam("id", stubtest.Matches(`^\d+$`)).
+		Reply(200).
+		Body(`{"id":"{{.Path.id}}"}`))
+	s.Stub(stubtest.Get("/users/0").Reply(404))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/users/42", wantStatus: 200, wantBody: `{"id":"42"}`},
+		{path: "/users/0", wantStatus: 404},
+		{path: "/users/abc", wantStatus: 404, wantBody: "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := s.Client().Get(s.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			b, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.path, res.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	s.Verify(stubtest.Get("/users/{id}").WithPathParam("id", stubtest.Matches(`^\d+$`)), stubtest.Exactly(2))
+	s.Verify(stubtest.Any("/users/abc"))
+	s.Verify(stubtest.Delete("/users/{id}"), stubtest.Never())
+}
+
+func Test_ServerQueryString(t *testing.T) {
+	s := stubtest.New(t)
+	s.Stub(stubtest.Get("/users?id=1").Reply(200).Body("user 1"))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/users?id=1", wantStatus: 200},
+		{path: "/users?page=2&id=1", wantStatus: 200},
+		{path: "/users?id=2", wantStatus: 404},
+		{path: "/users", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := s.Client().Get(s.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("GET %s = %d, want %d", tt.path, res.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	s.Verify(stubtest.Get("/users?id=1"), stubtest.Exactly(2))
+	s.Verify(stubtest.Get("/users?id=2"), stubtest.Exactly(1))
+}
+
+// fakeT records the errors of a test instead of failing it.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Error(args ...any) { t.errors = append(t.errors, fmt.Sprint(args...)) }
+
+// Fatalf records the error and stops the calling goroutine, as testing.T does.
+func (t *fakeT) Fatalf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+func Test_ServerVerifyInvalidBuilder(t *testing.T) {
+	ft := &fakeT{TB: t}
+	s := stubtest.New(ft)
+	res, err := s.Client().Get(s.URL + "/search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Verify(stubtest.Get("/search?q=%zz"), stubtest.Exactly(1))
+	}()
+	<-done
+	want := []string{`Invalid verification: invalid URL escape "%zz"`}
+	if diff := cmp.Diff(want, ft.errors); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ServerVerifyFailure(t *testing.T) {
+	ft := &fakeT{TB: t}
+	s := stubtest.New(ft)
+	res, err := s.Client().Post(s.URL+"/payments", "application/json", strings.NewReader(`{"amount":100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	s.Verify(stubtest.Post("/payments").WithBody(stubtest.Contains(`"amount":300`)), stubtest.Exactly(1))
+	want := []string{`expected exactly 1 request(s) matching {"urlPath":"/payments","method":"POST","body":{"contains":"\"amount\":300"}}, received 0
+near miss: POST /payments
+  body (-want +got):
+    - {"contains":"\"amount\":300"}
+    + {"amount":100}`}
+	if diff := cmp.Diff(want, ft.errors); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+}
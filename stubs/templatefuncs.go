@@ -0,0 +1,300 @@
+package stubs
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	_ "time/tzdata"
+	"unicode"
+)
+
+// templateFuncs are the functions available in response templates. Functions
+// that take the value to transform take it last, so they can be used in pipelines
+// like {{.Query.name | replace "-" "_" | upper}}.
+var templateFuncs = template.FuncMap{
+	"now":          now,
+	"uuid":         newUUID,
+	"randomInt":    randomInt,
+	"randomString": randomString,
+	"add":          arithmetic(func(a, b float64) float64 { return a + b }),
+	"sub":          arithmetic(func(a, b float64) float64 { return a - b }),
+	"mul":          arithmetic(func(a, b float64) float64 { return a * b }),
+	"div":          divide,
+	"mod":          modulo,
+	"max":          arithmetic(math.Max),
+	"min":          arithmetic(math.Min),
+	"round":        round,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"title":        title,
+	"trim":         strings.TrimSpace,
+	"trimPrefix":   func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":   func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":      func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"base64":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64Decode": base64Decode,
+	"urlEncode":    url.QueryEscape,
+	"toJson":       toJSON,
+	"jsonEscape":   jsonEscape,
+	"env":          os.Getenv,
+	"default":      defaultValue,
+	"jsonPath":     jsonPath,
+	"xPath":        xPath,
+	"formValue":    formValue,
+}
+
+// now formats the current time. The optional arguments are a layout (Go layout,
+// or unix / unixMilli), an offset such as -1h30m or +7d, and a time zone name.
+func now(args ...string) (string, error) {
+	if len(args) > 3 {
+		return "", errors.New("now takes at most a format, an offset and a time zone")
+	}
+	args = append(args, "", "", "")
+	layout, offset, zone := args[0], args[1], args[2]
+
+	t := time.Now()
+	if offset != "" {
+		d, err := parseOffset(offset)
+		if err != nil {
+			return "", err
+		}
+		t = t.Add(d)
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return "", err
+		}
+		t = t.In(loc)
+	}
+	switch layout {
+	case "":
+		return t.Format(time.RFC3339), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "unixMilli":
+		return strconv.FormatInt(t.UnixMilli(), 10), nil
+	}
+	return t.Format(layout), nil
+}
+
+// parseOffset parses a duration, additionally accepting days (d).
+func parseOffset(offset string) (time.Duration, error) {
+	sign := time.Duration(1)
+	s := offset
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	var d time.Duration
+	if days, rest, ok := strings.Cut(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q", offset)
+		}
+		d, s = time.Duration(n)*24*time.Hour, rest
+	}
+	if s != "" {
+		rest, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q", offset)
+		}
+		d += rest
+	}
+	return sign * d, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomInt returns a random integer in [min, max].
+func randomInt(minValue, maxValue any) (int64, error) {
+	lo, err := toNumber(minValue)
+	if err != nil {
+		return 0, err
+	}
+	hi, err := toNumber(maxValue)
+	if err != nil {
+		return 0, err
+	}
+	if hi < lo {
+		return 0, errors.New("randomInt: max is less than min")
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi)-int64(lo)+1))
+	if err != nil {
+		return 0, err
+	}
+	return int64(lo) + n.Int64(), nil
+}
+
+const alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomString returns n random characters, taken from the optional charset or
+// from letters and digits.
+func randomString(length any, charset ...string) (string, error) {
+	n, err := toNumber(length)
+	if err != nil {
+		return "", err
+	}
+	chars := []rune(alphanumeric)
+	if len(charset) > 0 && charset[0] != "" {
+		chars = []rune(charset[0])
+	}
+	var sb strings.Builder
+	for range int(n) {
+		i, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(chars[i.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// toNumber converts numbers and numeric strings, such as path or query
+// parameters, into a float64.
+func toNumber(v any) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", n)
+		}
+		return f, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// number returns integral results as int64 so that they print without exponent.
+func number(f float64) any {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+func arithmetic(op func(a, b float64) float64) func(a, b any) (any, error) {
+	return func(a, b any) (any, error) {
+		x, err := toNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := toNumber(b)
+		if err != nil {
+			return nil, err
+		}
+		return number(op(x, y)), nil
+	}
+}
+
+func divide(a, b any) (any, error) {
+	if y, err := toNumber(b); err == nil && y == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return arithmetic(func(a, b float64) float64 { return a / b })(a, b)
+}
+
+func modulo(a, b any) (any, error) {
+	if y, err := toNumber(b); err == nil && y == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return arithmetic(math.Mod)(a, b)
+}
+
+// round rounds to the given number of decimal places.
+func round(places, v any) (any, error) {
+	p, err := toNumber(places)
+	if err != nil {
+		return nil, err
+	}
+	f, err := toNumber(v)
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow(10, p)
+	return number(math.Round(f*scale) / scale), nil
+}
+
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) || prev == '-' || prev == '_' {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
+
+func base64Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// toJSON encodes a value as JSON.
+func toJSON(v any) (string, error) {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// jsonEscape escapes a string for use between the quotes of a JSON string.
+func jsonEscape(v any) (string, error) {
+	s, err := toJSON(fmt.Sprint(v))
+	if err != nil {
+		return "", err
+	}
+	return s[1 : len(s)-1], nil
+}
+
+// defaultValue returns def when v is missing or empty.
+func defaultValue(def, v any) any {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return def
+		}
+	}
+	return v
+}
@@ -0,0 +1,83 @@
+package stubs
+
+import (
+	"regexp"
+	"testing"
+)
+
+func Test_templateFuncs(t *testing.T) {
+	t.Setenv("API_STUBS_TEST_ENV", "from-env")
+	gp := TemplateData{
+		Path:  map[string]string{"id": "42", "name": "jane-doe"},
+		Query: map[string]string{"q": "a b&c", "price": "19.99"},
+	}
+	tests := []struct {
+		name    string
+		tpl     string
+		want    string
+		wantErr bool
+	}{
+		{name: "add", tpl: `{{add .Path.id 8}}`, want: "50"},
+		{name: "sub", tpl: `{{sub 10 .Path.id}}`, want: "-32"},
+		{name: "mul", tpl: `{{mul .Query.price 2}}`, want: "39.98"},
+		{name: "div", tpl: `{{div 7 2}}`, want: "3.5"},
+		{name: "div by zero", tpl: `{{div 7 0}}`, wantErr: true},
+		{name: "mod", tpl: `{{mod 7 3}}`, want: "1"},
+		{name: "max min", tpl: `{{max 1 2}} {{min 1 2}}`, want: "2 1"},
+		{name: "round", tpl: `{{round 1 .Query.price}}`, want: "20"},
+		{name: "not a number", tpl: `{{add "x" 1}}`, wantErr: true},
+		{name: "upper lower", tpl: `{{upper "abc"}} {{lower "ABC"}}`, want: "ABC abc"},
+		{name: "title", tpl: `{{title .Path.name}}`, want: "Jane-Doe"},
+		{name: "trim", tpl: `{{trim "  x "}}|{{trimPrefix "/" "/a"}}|{{trimSuffix ".json" "a.json"}}`, want: "x|a|a"},
+		{name: "replace pipeline", tpl: `{{.Path.name | replace "-" "_" | upper}}`, want: "JANE_DOE"},
+		{name: "base64", tpl: `{{base64 "user:pass"}} {{base64Decode "dXNlcjpwYXNz"}}`, want: "dXNlcjpwYXNz user:pass"},
+		{name: "urlEncode", tpl: `{{urlEncode .Query.q}}`, want: "a+b%26c"},
+		{name: "toJson", tpl: `{{toJson .Query.q}}`, want: `"a b&c"`},
+		{name: "jsonEscape", tpl: `{"q": "{{jsonEscape "say \"hi\"\n"}}"}`, want: `{"q": "say \"hi\"\n"}`},
+		{name: "env", tpl: `{{env "API_STUBS_TEST_ENV"}}`, want: "from-env"},
+		{name: "default", tpl: `{{.Query.limit | default "10"}} {{.Path.id | default "0"}}`, want: "10 42"},
+		{name: "now bad offset", tpl: `{{now "" "soon"}}`, wantErr: true},
+		{name: "now bad zone", tpl: `{{now "" "" "Nowhere/Nothing"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate(tt.tpl, gp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("renderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_templateFuncs_random(t *testing.T) {
+	gp := TemplateData{}
+	tests := []struct {
+		name string
+		tpl  string
+		want *regexp.Regexp
+	}{
+		{name: "uuid", tpl: `{{uuid}}`, want: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "randomInt", tpl: `{{randomInt 5 7}}`, want: regexp.MustCompile(`^[5-7]$`)},
+		{name: "randomString", tpl: `{{randomString 12}}`, want: regexp.MustCompile(`^[A-Za-z0-9]{12}$`)},
+		{name: "randomString charset", tpl: `{{randomString 6 "ab"}}`, want: regexp.MustCompile(`^[ab]{6}$`)},
+		{name: "now layout and zone", tpl: `{{now "2006-01-02T15:04:05Z07:00" "-2d" "Asia/Tokyo"}}`, want: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\+09:00$`)},
+		{name: "now unix", tpl: `{{now "unixMilli" "+1h"}}`, want: regexp.MustCompile(`^\d{13}$`)},
+		{name: "now default", tpl: `{{now}}`, want: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				got, err := renderTemplate(tt.tpl, gp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.want.MatchString(got) {
+					t.Fatalf("renderTemplate() = %q, want match of %s", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package stubs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// TransformedResponse is the response passed through the transformers of a stub.
+type TransformedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Data   TemplateData // テンプレートに渡すリクエストの値
+}
+
+// Transformer rewrites a response. parameters are the stub's
+// transformerParameters entry for the transformer, or nil.
+type Transformer interface {
+	Transform(response *TransformedResponse, parameters json.RawMessage) error
+}
+
+// TransformerFunc adapts a function to the Transformer interface.
+type TransformerFunc func(response *TransformedResponse, parameters json.RawMessage) error
+
+func (f TransformerFunc) Transform(response *TransformedResponse, parameters json.RawMessage) error {
+	return f(response, parameters)
+}
+
+// transformersMu guards transformers, which RegisterTransformer may change while servers run.
+var transformersMu sync.RWMutex
+
+var transformers = map[string]Transformer{
+	"template":   TransformerFunc(templateTransformer),
+	"jsonPatch":  TransformerFunc(jsonPatchTransformer),
+	"gzip":       TransformerFunc(gzipTransformer),
+	"minifyJson": TransformerFunc(minifyJSONTransformer),
+	"prettyJson": TransformerFunc(prettyJSONTransformer),
+	"none":       TransformerFunc(func(*TransformedResponse, json.RawMessage) error { return nil }),
+}
+
+// RegisterTransformer makes a transformer available to stubs under name.
+func RegisterTransformer(name string, t Transformer) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	transformers[name] = t
+}
+
+func lookupTransformer(name string) (Transformer, bool) {
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+	t, ok := transformers[name]
+	return t, ok
+}
+
+// transform runs the stub's transformers in order. Stubs without a list are
+// rendered as templates, except for datasets which are data.
+func transform(response Response, tr *TransformedResponse) error {
+	names := response.Transformaers
+	if len(names) == 0 && response.Dataset == nil {
+		names = []string{"template"}
+	}
+	for _, name := range names {
+		t, ok := lookupTransformer(name)
+		if !ok {
+			return fmt.Errorf("unknown transformer %q", name)
+		}
+		if err := t.Transform(tr, response.TransformerParameters[name]); err != nil {
+			return fmt.Errorf("transformer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+type templateParameters struct {
+	LeftDelim  string `json:"leftDelim,omitempty"`  // 既定値は {{
+	RightDelim string `json:"rightDelim,omitempty"` // 既定値は }}
+}
+
+// templateTransformer renders the body as a text/template with the request values.
+func templateTransformer(response *TransformedResponse, parameters json.RawMessage) error {
+	var p templateParameters
+	if err := unmarshalParameters(parameters, &p); err != nil {
+		return err
+	}
+	tpl, err := template.New("response").Delims(p.LeftDelim, p.RightDelim).Funcs(templateFuncs).Parse(string(response.Body))
+	if err != nil {
+		return fmt.Errorf("failed to parse response template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, response.Data); err != nil {
+		return fmt.Errorf("failed to execute response template: %w", err)
+	}
+	response.Body = buf.Bytes()
+	return nil
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonPatchTransformer applies an RFC 6902 JSON Patch, given as the parameters,
+// to the JSON body.
+func jsonPatchTransformer(response *TransformedResponse, parameters json.RawMessage) error {
+	var ops []jsonPatchOperation
+	if err := unmarshalParameters(parameters, &ops); err != nil {
+		return err
+	}
+	doc, err := decodeJSON(response.Body)
+	if err != nil {
+		return fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+	for _, op := range ops {
+		var value any
+		if op.Value != nil {
+			if value, err = decodeJSON(op.Value); err != nil {
+				return err
+			}
+		}
+		switch op.Op {
+		case "add":
+			doc, err = jsonPointerSet(doc, op.Path, value, true)
+		case "replace":
+			if _, err = jsonPointerGet(doc, op.Path); err == nil {
+				doc, err = jsonPointerSet(doc, op.Path, value, false)
+			}
+		case "remove":
+			doc, _, err = jsonPointerRemove(doc, op.Path)
+		case "move":
+			var moved any
+			if doc, moved, err = jsonPointerRemove(doc, op.From); err == nil {
+				doc, err = jsonPointerSet(doc, op.Path, moved, true)
+			}
+		case "copy":
+			var copied any
+			if copied, err = jsonPointerGet(doc, op.From); err == nil {
+				doc, err = jsonPointerSet(doc, op.Path, copied, true)
+			}
+		case "test":
+			var got any
+			if got, err = jsonPointerGet(doc, op.Path); err == nil && valueString(got) != valueString(value) {
+				err = fmt.Errorf("test failed at %s", op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	response.Body = b
+	return nil
+}
+
+func decodeJSON(b []byte) (any, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func splitJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !allowEnd) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func jsonPointerGet(doc any, pointer string) (any, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, t := range tokens {
+		switch v := current.(type) {
+		case map[string]any:
+			c, ok := v[t]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			current = c
+		case []any:
+			i, err := arrayIndex(t, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			current = v[i]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	}
+	return current, nil
+}
+
+// jsonPointerSet sets the value at pointer. With insert, array elements are
+// inserted instead of replaced.
+func jsonPointerSet(doc any, pointer string, value any, insert bool) (any, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := jsonPointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		p[last] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(p), insert)
+		if err != nil {
+			return nil, err
+		}
+		if insert {
+			p = append(p[:i], append([]any{value}, p[i:]...)...)
+		} else {
+			p[i] = value
+		}
+		return jsonPointerSet(doc, parentPointer, p, false)
+	}
+	return nil, fmt.Errorf("path %s does not exist", parentPointer)
+}
+
+func jsonPointerRemove(doc any, pointer string) (any, any, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := jsonPointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		removed, ok := p[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+		delete(p, last)
+		return doc, removed, nil
+	case []any:
+		i, err := arrayIndex(last, len(p), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := p[i]
+		p = append(p[:i:i], p[i+1:]...)
+		doc, err = jsonPointerSet(doc, parentPointer, p, false)
+		return doc, removed, err
+	}
+	return nil, nil, fmt.Errorf("path %s does not exist", pointer)
+}
+
+type gzipParameters struct {
+	Level int `json:"level,omitempty"` // 1 (速度優先) から 9 (圧縮率優先)。既定値は 6
+}
+
+// gzipTransformer compresses the body and sets Content-Encoding. The
+// Content-Type is inferred beforehand, as it can't be from the compressed body.
+func gzipTransformer(response *TransformedResponse, parameters json.RawMessage) error {
+	p := gzipParameters{Level: gzip.DefaultCompression}
+	if err := unmarshalParameters(parameters, &p); err != nil {
+		return err
+	}
+	if response.Header.Get("Content-Type") == "" {
+		if contentType := defaultContentType(Response{}, string(response.Body)); contentType != "" {
+			response.Header.Set("Content-Type", contentType)
+		}
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, p.Level)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(response.Body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	response.Body = buf.Bytes()
+	response.Header.Set("Content-Encoding", "gzip")
+	response.Header.Del("Content-Length")
+	return nil
+}
+
+func minifyJSONTransformer(response *TransformedResponse, _ json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, response.Body); err != nil {
+		return fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+	response.Body = buf.Bytes()
+	return nil
+}
+
+type prettyJSONParameters struct {
+	Indent *string `json:"indent,omitempty"` // 既定値は空白 2 つ
+}
+
+func prettyJSONTransformer(response *TransformedResponse, parameters json.RawMessage) error {
+	var p prettyJSONParameters
+	if err := unmarshalParameters(parameters, &p); err != nil {
+		return err
+	}
+	indent := "  "
+	if p.Indent != nil {
+		indent = *p.Indent
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(response.Body), "", indent); err != nil {
+		return fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+	buf.WriteByte('\n')
+	response.Body = buf.Bytes()
+	return nil
+}
+
+func unmarshalParameters(parameters json.RawMessage, v any) error {
+	if len(parameters) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(parameters, v); err != nil {
+		return fmt.Errorf("invalid parameters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package stubs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_transform(t *testing.T) {
+	tests := []struct {
+		name     string
+		response Response
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "template by default",
+			response: Response{Body: `{"id": "{{.Path.id}}"}`},
+			want:     `{"id": "42"}`,
+		},
+		{
+			name:     "no template when not listed",
+			response: Response{Body: `{{.Path.id}}`, Transformaers: []string{"minifyJson"}},
+			wantErr:  true,
+		},
+		{
+			name: "template delimiters",
+			response: Response{
+				Body:                  `{"id": "[[.Path.id]]", "raw": "{{x}}"}`,
+				Transformaers:         []string{"template"},
+				TransformerParameters: map[string]json.RawMessage{"template": json.RawMessage(`{"leftDelim": "[[", "rightDelim": "]]"}`)},
+			},
+			want: `{"id": "42", "raw": "{{x}}"}`,
+		},
+		{
+			name:     "template then minify",
+			response: Response{Body: "{\n  \"id\": {{.Path.id}},\n  \"ok\": true\n}", Transformaers: []string{"template", "minifyJson"}},
+			want:     `{"id":42,"ok":true}`,
+		},
+		{
+			name: "pretty",
+			response: Response{
+				Body:                  `{"a":[1,2]}`,
+				Transformaers:         []string{"prettyJson"},
+				TransformerParameters: map[string]json.RawMessage{"prettyJson": json.RawMessage(`{"indent": "\t"}`)},
+			},
+			want: "{\n\t\"a\": [\n\t\t1,\n\t\t2\n\t]\n}\n",
+		},
+		{
+			name: "json patch",
+			response: Response{
+				Body:          `{"user": {"name": "jane", "role": "admin"}, "tags": ["a", "c"], "old": 1}`,
+				Transformaers: []string{"jsonPatch"},
+				TransformerParameters: map[string]json.RawMessage{"jsonPatch": json.RawMessage(`[
+					{"op": "test", "path": "/user/name", "value": "jane"},
+					{"op": "replace", "path": "/user/name", "value": "john"},
+					{"op": "remove", "path": "/user/role"},
+					{"op": "add", "path": "/tags/1", "value": "b"},
+					{"op": "add", "path": "/tags/-", "value": "d"},
+					{"op": "move", "from": "/old", "path": "/new"},
+					{"op": "copy", "from": "/tags/0", "path": "/first"}
+				]`)},
+			},
+			want: `{"first":"a","new":1,"tags":["a","b","c","d"],"user":{"name":"john"}}`,
+		},
+		{
+			name: "json patch test failure",
+			response: Response{
+				Body:                  `{"a": 1}`,
+				Transformaers:         []string{"jsonPatch"},
+				TransformerParameters: map[string]json.RawMessage{"jsonPatch": json.RawMessage(`[{"op": "test", "path": "/a", "value": 2}]`)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "json patch missing path",
+			response: Response{
+				Body:                  `{"a": 1}`,
+				Transformaers:         []string{"jsonPatch"},
+				TransformerParameters: map[string]json.RawMessage{"jsonPatch": json.RawMessage(`[{"op": "replace", "path": "/b", "value": 2}]`)},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown transformer",
+			response: Response{Body: "x", Transformaers: []string{"nope"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &TransformedResponse{
+				Status: http.StatusOK,
+				Header: http.Header{},
+				Body:   []byte(tt.response.Body),
+				Data:   TemplateData{Path: map[string]string{"id": "42"}},
+			}
+			err := transform(tt.response, tr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tt.want, string(tr.Body)); diff != "" {
+				t.Errorf("transform() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_transform_gzip(t *testing.T) {
+	tr := &TransformedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte(`{"id": "{{.Path.id}}"}`), Data: TemplateData{Path: map[string]string{"id": "7"}}}
+	response := Response{Transformaers: []string{"template", "gzip"}}
+	if err := transform(response, tr); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := tr.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(tr.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != `{"id": "7"}` {
+		t.Errorf("decompressed body = %q", got)
+	}
+}
+
+func Test_RegisterTransformer(t *testing.T) {
+	RegisterTransformer("upperCase", TransformerFunc(func(response *TransformedResponse, parameters json.RawMessage) error {
+		response.Body = []byte(strings.ToUpper(string(response.Body)))
+		response.Status = http.StatusAccepted
+		return nil
+	}))
+	t.Cleanup(func() { unregisterTransformer("upperCase") })
+	tr := &TransformedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte("hello")}
+	if err := transform(Response{Transformaers: []string{"upperCase"}}, tr); err != nil {
+		t.Fatal(err)
+	}
+	if string(tr.Body) != "HELLO" || tr.Status != http.StatusAccepted {
+		t.Errorf("transform() = %d %q", tr.Status, tr.Body)
+	}
+}
+
+func Test_RegisterTransformerWhileServing(t *testing.T) {
+	t.Cleanup(func() { unregisterTransformer("noop") })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			RegisterTransformer("noop", TransformerFunc(func(*TransformedResponse, json.RawMessage) error { return nil }))
+		}
+	}()
+	for range 100 {
+		tr := &TransformedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte("hello")}
+		if err := transform(Response{Transformaers: []string{"none"}}, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+// unregisterTransformer removes a transformer registered by a test.
+func unregisterTransformer(name string) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	delete(transformers, name)
+}
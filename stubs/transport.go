@@ -0,0 +1,298 @@
+package stubs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errHandlerAborted is returned to the client when a stub aborts the response.
+var errHandlerAborted = errors.New("stubs: handler aborted the response")
+
+// Transport returns an http.RoundTripper that answers requests from the
+// server's stubs in-process, whatever host they are sent to. Requests go
+// through the journal and the admin API as they do over the network.
+func (s *Server) Transport() http.RoundTripper {
+	return &transport{handler: s}
+}
+
+type transport struct {
+	handler http.Handler
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.ParseRequestURI(req.URL.RequestURI())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.RequestURI = u.RequestURI()
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+	r.Header.Del("Host")
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if r.ContentLength == 0 && r.Body != http.NoBody {
+		r.ContentLength = -1
+	}
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.1", 1, 1
+
+	pr, pw := io.Pipe()
+	w := &transportWriter{
+		req:      req,
+		header:   make(http.Header),
+		body:     pw,
+		response: make(chan *http.Response, 1),
+		hijacked: make(chan net.Conn, 1),
+		aborted:  make(chan error, 1),
+	}
+	go w.serve(t.handler, r)
+
+	ctx := req.Context()
+	select {
+	case res := <-w.response:
+		stop := context.AfterFunc(ctx, func() { pr.CloseWithError(ctx.Err()) })
+		res.Body = &stopBody{ReadCloser: pr, stop: stop}
+		return res, nil
+	case conn := <-w.hijacked:
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		return readHijackedResponse(conn, req, stop)
+	case err := <-w.aborted:
+		return nil, err
+	case <-ctx.Done():
+		pr.CloseWithError(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// readHijackedResponse reads what a stub wrote to a hijacked connection, as
+// a client reading from a socket would.
+func readHijackedResponse(conn net.Conn, req *http.Request, stop func() bool) (*http.Response, error) {
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	res.Body = &stopBody{ReadCloser: &connBody{ReadCloser: res.Body, conn: conn}, stop: stop}
+	return res, nil
+}
+
+// connBody closes the hijacked connection along with the response body.
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
+
+// stopBody stops watching the request's context once the body is read to
+// the end or closed, so a long-lived context doesn't keep the response.
+type stopBody struct {
+	io.ReadCloser
+	stop func() bool
+}
+
+func (b *stopBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.stop()
+	}
+	return n, err
+}
+
+func (b *stopBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// transportWriter is the http.ResponseWriter of a request served by the
+// transport. The response is handed to the client on the first write and the
+// body is streamed through a pipe.
+type transportWriter struct {
+	req    *http.Request
+	header http.Header
+	body   *io.PipeWriter
+
+	mu          sync.Mutex
+	wroteHeader bool
+	isHijacked  bool
+	res         *http.Response
+
+	response chan *http.Response
+	hijacked chan net.Conn
+	aborted  chan error
+}
+
+func (w *transportWriter) serve(handler http.Handler, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			if err != http.ErrAbortHandler {
+				slog.Error(fmt.Sprintf("Failed to serve in-process request: %v", err))
+			}
+			w.abort(errHandlerAborted)
+			return
+		}
+		w.finish()
+	}()
+	defer closeBody(w.req)
+	handler.ServeHTTP(w, r)
+}
+
+func (w *transportWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *transportWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeader(status)
+}
+
+func (w *transportWriter) writeHeader(status int) {
+	if w.wroteHeader || w.isHijacked {
+		return
+	}
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		return
+	}
+	w.wroteHeader = true
+	res := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header.Clone(),
+		ContentLength: -1,
+		Request:       w.req,
+	}
+	for key := range res.Header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			res.Header.Del(key)
+		}
+	}
+	if n, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64); err == nil {
+		res.ContentLength = n
+	}
+	if !bodyAllowed(w.req, status) {
+		res.ContentLength = 0
+	}
+	res.Trailer = make(http.Header)
+	for _, v := range res.Header.Values("Trailer") {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				res.Trailer[http.CanonicalHeaderKey(key)] = nil
+			}
+		}
+	}
+	w.res = res
+	w.response <- res
+}
+
+func (w *transportWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.isHijacked {
+		w.mu.Unlock()
+		return 0, http.ErrHijacked
+	}
+	if !w.wroteHeader {
+		if w.header.Get("Content-Type") == "" && w.header.Get("Transfer-Encoding") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.writeHeader(http.StatusOK)
+	}
+	allowed := bodyAllowed(w.req, w.res.StatusCode)
+	w.mu.Unlock()
+	if !allowed {
+		return len(p), nil
+	}
+	return w.body.Write(p)
+}
+
+// Flush sends the response headers. Body writes already reach the client as
+// they are read.
+func (w *transportWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// Hijack hands the stub one end of an in-memory connection. The client reads
+// the response from the other end.
+func (w *transportWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wroteHeader {
+		return nil, nil, errors.New("stubs: hijack after the response was sent")
+	}
+	w.isHijacked = true
+	server, client := net.Pipe()
+	w.hijacked <- client
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+// finish sends an empty 200 response if the stub wrote nothing, then ends the
+// body with the trailers the stub set.
+func (w *transportWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.isHijacked {
+		return
+	}
+	if !w.wroteHeader && w.header.Get("Content-Length") == "" {
+		w.header.Set("Content-Length", "0")
+	}
+	w.writeHeader(http.StatusOK)
+	for key, values := range w.header {
+		if name, ok := strings.CutPrefix(key, http.TrailerPrefix); ok {
+			w.res.Trailer[http.CanonicalHeaderKey(name)] = values
+		} else if _, declared := w.res.Trailer[key]; declared {
+			w.res.Trailer[key] = values
+		}
+	}
+	w.body.Close()
+}
+
+// abort fails the request, or the body when the response was already sent.
+func (w *transportWriter) abort(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.isHijacked:
+	case w.wroteHeader:
+		w.body.CloseWithError(err)
+	default:
+		w.wroteHeader = true
+		w.aborted <- err
+	}
+}
+
+// bodyAllowed reports whether a response to req with status carries a body.
+func bodyAllowed(req *http.Request, status int) bool {
+	if req.Method == http.MethodHead {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified && (status < 100 || status >= 200)
+}
@@ -0,0 +1,229 @@
+package stubs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Transport(t *testing.T) {
+	silenceLogs(t)
+	server, err := NewServer(Options{
+		Endpoints: []Endpoint{
+			{
+				Request:  Request{Method: "GET", URLPathTemplate: "/greet/{name}", PathParameters: map[string]Matcher{"name": {Matches: ".+"}}},
+				Response: Response{Body: "hello {{.Path.name}}"},
+			},
+			{
+				Request:  Request{Method: "POST", URLPath: "/orders", Body: Matcher{Contains: `"qty":2`}},
+				Response: Response{Status: 201, Body: `{"id":1}`, Headers: map[string]HeaderValues{"Content-Type": {"application/json"}}},
+			},
+			{Request: Request{Method: "GET", URLPath: "/empty"}, Response: Response{Fault: "EMPTY_RESPONSE"}},
+			{Request: Request{Method: "GET", URLPath: "/reset"}, Response: Response{Fault: "CONNECTION_RESET_BY_PEER"}},
+			{Request: Request{Method: "GET", URLPath: "/truncated"}, Response: Response{Body: "0123456789", Fault: "TRUNCATED_BODY"}},
+			{Request: Request{Method: "GET", URLPath: "/hang"}, Response: Response{Fault: "HANG"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := &http.Client{Transport: server.Transport()}
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		body            string
+		timeout         time.Duration
+		wantStatus      int
+		wantBody        string
+		wantContentType string
+		wantErr         bool
+		wantBodyErr     bool
+	}{
+		{name: "template", method: "GET", url: "http://users.internal/greet/gopher", wantStatus: 200, wantBody: "hello gopher", wantContentType: "text/plain; charset=utf-8"},
+		{name: "body matcher", method: "POST", url: "https://orders.example.com/orders", body: `{"qty":2}`, wantStatus: 201, wantBody: `{"id":1}`, wantContentType: "application/json"},
+		{name: "unmatched", method: "POST", url: "http://orders.example.com/orders", body: `{"qty":3}`, wantStatus: 404, wantBody: "404 page not found\n", wantContentType: "text/plain; charset=utf-8"},
+		{name: "head", method: "HEAD", url: "http://users.internal/greet/gopher", wantStatus: 404, wantContentType: "text/plain; charset=utf-8"},
+		{name: "admin", method: "GET", url: "http://stubs/__admin/scenarios", wantStatus: 200, wantBody: "[]\n", wantContentType: "application/json"},
+		{name: "empty response", method: "GET", url: "http://faults/empty", wantErr: true},
+		{name: "connection reset", method: "GET", url: "http://faults/reset", wantErr: true},
+		{name: "truncated body", method: "GET", url: "http://faults/truncated", wantStatus: 200, wantBody: "01234", wantContentType: "text/plain; charset=utf-8", wantBodyErr: true},
+		{name: "hang", method: "GET", url: "http://faults/hang", timeout: 50 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			if (err != nil) != tt.wantBodyErr {
+				t.Errorf("reading body error = %v, wantBodyErr %v", err, tt.wantBodyErr)
+			}
+			if res.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.url, res.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+			if got := res.Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+
+	one := 1
+	result, err := server.Verify(Verification{Request: Request{Method: "POST", URLPath: "/orders", Body: Matcher{Contains: `"qty":2`}}, Exactly: &one})
+	if err == nil {
+		err = result.Err()
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_TransportStreaming(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, "first,")
+		<-release
+		_, _ = io.WriteString(w, "second")
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Status", "done")
+	})
+	res, err := (&http.Client{Transport: &transport{handler: handler}}).Get("http://stream/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want 202", res.StatusCode)
+	}
+	first := make([]byte, len("first,"))
+	if _, err := io.ReadFull(res.Body, first); err != nil || string(first) != "first," {
+		t.Fatalf("first read = %q, %v; want the body written before the handler returned", first, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(res.Body)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("rest of body = %q, %v; want %q", rest, err, "second")
+	}
+	want := http.Header{"X-Checksum": {"abc"}, "X-Status": {"done"}}
+	if diff := cmp.Diff(want, res.Trailer); diff != "" {
+		t.Errorf("trailers mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_TransportPanic(t *testing.T) {
+	silenceLogs(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	_, err := (&http.Client{Transport: &transport{handler: handler}}).Get("http://panic/")
+	if err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Errorf("Get() error = %v, want the aborted response", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Get() error = %v, want no cancellation", err)
+	}
+}
+
+func Test_TransportParallel(t *testing.T) {
+	server, err := NewServer(Options{
+		Endpoints: []Endpoint{{Request: Request{Method: "GET", URLPath: "/ping"}, Response: Response{Body: "pong"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: server.Transport()}
+	const n = 50
+	t.Run("requests", func(t *testing.T) {
+		for i := range n {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				t.Parallel()
+				res, err := client.Get("http://service-" + strconv.Itoa(i) + "/ping")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer res.Body.Close()
+				if b, _ := io.ReadAll(res.Body); string(b) != "pong" {
+					t.Errorf("body = %q, want pong", b)
+				}
+			})
+		}
+	})
+	if got := len(server.Requests()); got != n {
+		t.Errorf("journaled %d requests, want %d", got, n)
+	}
+}
+
+func Test_TransportStopsWatchingContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/truncated" {
+			if err := injectFault(w, r, "TRUNCATED_BODY", &TransformedResponse{Status: 200, Header: http.Header{}, Body: []byte("0123")}); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	})
+	client := &http.Client{Transport: &transport{handler: handler}}
+	tests := []struct {
+		name string
+		path string
+		read bool // 閉じる前に最後まで読む
+	}{
+		{name: "read to the end", path: "/", read: true},
+		{name: "closed early", path: "/"},
+		{name: "hijacked", path: "/truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://watch"+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, ok := res.Body.(*stopBody)
+			if !ok {
+				t.Fatalf("body is %T, want *stopBody", res.Body)
+			}
+			if tt.read {
+				_, _ = io.ReadAll(res.Body)
+			} else {
+				res.Body.Close()
+			}
+			if body.stop() {
+				t.Error("the context was still watched after the body was done")
+			}
+			res.Body.Close()
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package stubs
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// validateEndpoint checks the settings of a stub that would otherwise fail
+// every request it matches. The error names the field.
+func validateEndpoint(e Endpoint) error {
+	if err := validateRequest(e.Request); err != nil {
+		return err
+	}
+	if err := validateResponse("response", e.Response); err != nil {
+		return err
+	}
+	for i, r := range e.Responses {
+		if err := validateResponse(fmt.Sprintf("responses[%d]", i), r); err != nil {
+			return err
+		}
+	}
+	for i, r := range e.RandomResponses {
+		if err := validateResponse(fmt.Sprintf("randomResponses[%d]", i), r.Response); err != nil {
+			return err
+		}
+	}
+	switch e.SequenceEnd {
+	case "", sequenceRepeatLast, sequenceCycle, sequenceFallThrough:
+	default:
+		return fmt.Errorf("sequenceEnd: unknown value %q", e.SequenceEnd)
+	}
+	return nil
+}
+
+func validateResponse(field string, r Response) error {
+	if r.Fault != "" && !validFault(r.Fault) {
+		return fmt.Errorf("%s.fault: unknown fault %q", field, r.Fault)
+	}
+	for _, name := range r.Transformaers {
+		if _, ok := lookupTransformer(name); !ok {
+			return fmt.Errorf("%s.transformers: unknown transformer %q", field, name)
+		}
+	}
+	if r.GRPC != nil {
+		if _, err := grpcCode(r.GRPC.Code); err != nil {
+			return fmt.Errorf("%s.grpc.code: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// validateRequest compiles the patterns of a request pattern, so a bad one is
+// reported up front instead of panicking while requests are matched. The
+// error names the field.
+func validateRequest(r Request) error {
+	for _, p := range []struct{ field, pattern string }{
+		{"urlPattern", r.URLPattern},
+		{"urlPathPattern", r.URLPathPattern},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		// matched as pathMatcher does, without trailing slashes
+		if _, err := regexp.Compile(strings.TrimRight(p.pattern, "/")); err != nil {
+			return fmt.Errorf("request.%s: %w", p.field, err)
+		}
+	}
+	if err := validateMatchers("request.queryParameters", r.QueryParameters); err != nil {
+		return err
+	}
+	if err := validateMatchers("request.pathParameters", r.PathParameters); err != nil {
+		return err
+	}
+	if err := validateMatcher("request.body", r.Body); err != nil {
+		return err
+	}
+	if r.Auth != nil && r.Auth.JWT != nil {
+		if err := validateMatchers("request.auth.jwt.claims", r.Auth.JWT.Claims); err != nil {
+			return err
+		}
+	}
+	if r.GraphQL != nil {
+		if err := validateMatcher("request.graphql.operationName", r.GraphQL.OperationName); err != nil {
+			return err
+		}
+		if err := validateMatchers("request.graphql.variables", r.GraphQL.Variables); err != nil {
+			return err
+		}
+	}
+	if r.GRPC != nil {
+		if err := validateMatchers("request.grpc.message", r.GRPC.Message); err != nil {
+			return err
+		}
+	}
+	if r.JSONRPC != nil {
+		if err := validateMatchers("request.jsonrpc.params", r.JSONRPC.Params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateMatchers(field string, matchers map[string]Matcher) error {
+	for _, name := range slices.Sorted(maps.Keys(matchers)) {
+		if err := validateMatcher(field+"."+name, matchers[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMatcher compiles the regular expressions of a matcher as valueMatcher does.
+func validateMatcher(field string, m Matcher) error {
+	if m.Matches != nil {
+		if _, err := regexp.Compile(fmt.Sprint(m.Matches)); err != nil {
+			return fmt.Errorf("%s.matches: %w", field, err)
+		}
+	}
+	if m.DoesNotMatch != nil {
+		if _, err := regexp.Compile(fmt.Sprint(m.DoesNotMatch)); err != nil {
+			return fmt.Errorf("%s.doesNotMatch: %w", field, err)
+		}
+	}
+	return nil
+}
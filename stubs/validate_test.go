@@ -0,0 +1,54 @@
+package stubs
+
+import "testing"
+
+func Test_validateEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  string
+	}{
+		{name: "valid", endpoint: Endpoint{Response: Response{Fault: faultHang, Transformaers: []string{"template"}}, SequenceEnd: sequenceCycle}},
+		{name: "request", endpoint: Endpoint{Request: Request{URLPathPattern: "("}}, wantErr: "request.urlPathPattern: error parsing regexp: missing closing ): `(`"},
+		{name: "sequence response fault", endpoint: Endpoint{Responses: []Response{{}, {Fault: "EXPLODE"}}}, wantErr: `responses[1].fault: unknown fault "EXPLODE"`},
+		{name: "random response transformer", endpoint: Endpoint{RandomResponses: []WeightedResponse{{Weight: 1, Response: Response{Transformaers: []string{"nope"}}}}}, wantErr: `randomResponses[0].transformers: unknown transformer "nope"`},
+		{name: "grpc code", endpoint: Endpoint{Response: Response{GRPC: &GRPCResponse{Code: "BROKEN"}}}, wantErr: `response.grpc.code: unknown gRPC status code "BROKEN"`},
+		{name: "sequence end", endpoint: Endpoint{SequenceEnd: "loop"}, wantErr: `sequenceEnd: unknown value "loop"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := ""
+			if err := validateEndpoint(tt.endpoint); err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("validateEndpoint() error = %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		wantErr string
+	}{
+		{name: "valid", request: Request{URLPathPattern: "^/users/[0-9]+/$", Body: Matcher{Matches: ".*", DoesNotMatch: "^$"}}},
+		{name: "url pattern", request: Request{URLPattern: "/users/(["}, wantErr: "request.urlPattern: error parsing regexp: missing closing ]: `[`"},
+		{name: "query parameter", request: Request{QueryParameters: map[string]Matcher{"id": {DoesNotMatch: "*"}}}, wantErr: "request.queryParameters.id.doesNotMatch: error parsing regexp: missing argument to repetition operator: `*`"},
+		{name: "jwt claim", request: Request{Auth: &Auth{JWT: &JWTAuth{Claims: map[string]Matcher{"sub": {Matches: "("}}}}}, wantErr: "request.auth.jwt.claims.sub.matches: error parsing regexp: missing closing ): `(`"},
+		{name: "graphql variable", request: Request{GraphQL: &GraphQLRequest{Variables: map[string]Matcher{"id": {Matches: "("}}}}, wantErr: "request.graphql.variables.id.matches: error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := ""
+			if err := validateRequest(tt.request); err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("validateRequest() error = %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package stubs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Verification is a request pattern with the number of matching requests
+// expected in the journal. Unset counts are not checked.
+type Verification struct {
+	Request Request `json:"request"` // method と URL を省略した場合は、すべてのメソッドと URL に一致する
+	Exactly *int    `json:"exactly,omitempty"`
+	AtLeast *int    `json:"atLeast,omitempty"`
+	AtMost  *int    `json:"atMost,omitempty"`
+}
+
+// VerificationResult lists the journaled requests matching a Verification.
+type VerificationResult struct {
+	Count    int                  `json:"count"`
+	Requests []JournalEntry       `json:"requests"`          // 古い順
+	Failure  *VerificationFailure `json:"failure,omitempty"` // 期待した回数でない場合に設定される
+}
+
+// VerificationFailure describes a count that was not met.
+type VerificationFailure struct {
+	Expected   string     `json:"expected"` // 例: "exactly 1", "at least 1 and at most 3"
+	Actual     int        `json:"actual"`
+	Request    Request    `json:"request"`
+	Message    string     `json:"message"`
+	NearMisses []NearMiss `json:"nearMisses,omitempty"` // 受け取った数が少ない場合に、一致しなかった部分が少ないリクエスト (最大 3 件)
+}
+
+// NearMiss is a journaled request that did not match a pattern, with the parts
+// of the pattern it missed.
+type NearMiss struct {
+	Request    JournalEntry `json:"request"`
+	Mismatches []Mismatch   `json:"mismatches"`
+}
+
+// Mismatch is a part of a pattern a request did not meet.
+type Mismatch struct {
+	Field    string `json:"field"`    // method, url, auth, query, body, graphql, soap, jsonrpc
+	Expected string `json:"expected"` // パターンのその部分 (method 以外は JSON)
+	Actual   string `json:"actual"`   // リクエストのその部分
+}
+
+// maxNearMisses is the number of near misses reported with a failure.
+const maxNearMisses = 3
+
+// Err returns the failure as an error, or nil when the verification passed.
+func (r VerificationResult) Err() error {
+	if r.Failure == nil {
+		return nil
+	}
+	return errors.New(r.Failure.Message)
+}
+
+// verify matches the pattern against the requests in the journal's memory.
+// It fails when the pattern is invalid.
+func (j *journal) verify(v Verification) (VerificationResult, error) {
+	if err := validateRequest(v.Request); err != nil {
+		return VerificationResult{}, err
+	}
+	result := VerificationResult{Requests: []JournalEntry{}}
+	var misses []NearMiss
+	for _, e := range j.list() {
+		mismatches := journalMismatches(v.Request, e)
+		if len(mismatches) == 0 {
+			result.Requests = append(result.Requests, e)
+			continue
+		}
+		misses = append(misses, NearMiss{Request: e, Mismatches: mismatches})
+	}
+	result.Count = len(result.Requests)
+
+	var expected []string
+	ok := true
+	if v.Exactly != nil {
+		expected = append(expected, fmt.Sprintf("exactly %d", *v.Exactly))
+		ok = ok && result.Count == *v.Exactly
+	}
+	if v.AtLeast != nil {
+		expected = append(expected, fmt.Sprintf("at least %d", *v.AtLeast))
+		ok = ok && result.Count >= *v.AtLeast
+	}
+	if v.AtMost != nil {
+		expected = append(expected, fmt.Sprintf("at most %d", *v.AtMost))
+		ok = ok && result.Count <= *v.AtMost
+	}
+	if !ok {
+		pattern, _ := json.Marshal(v.Request)
+		f := &VerificationFailure{
+			Expected: strings.Join(expected, " and "),
+			Actual:   result.Count,
+			Request:  v.Request,
+		}
+		f.Message = fmt.Sprintf("expected %s request(s) matching %s, received %d", f.Expected, pattern, f.Actual)
+		if (v.Exactly != nil && result.Count < *v.Exactly) || (v.AtLeast != nil && result.Count < *v.AtLeast) {
+			slices.SortStableFunc(misses, func(a, b NearMiss) int {
+				return len(a.Mismatches) - len(b.Mismatches)
+			})
+			f.NearMisses = misses[:min(len(misses), maxNearMisses)]
+		}
+		result.Failure = f
+	}
+	return result, nil
+}
+
+// journalMismatches returns the parts of the pattern a journaled request does
+// not meet, with the same matchers stubs use. Truncated bodies are matched as
+// they were kept.
+func journalMismatches(request Request, e JournalEntry) []Mismatch {
+	var mismatches []Mismatch
+	if request.Method != "" && !strings.EqualFold(request.Method, e.Method) {
+		mismatches = append(mismatches, Mismatch{Field: "method", Expected: request.Method, Actual: e.Method})
+	}
+	urlPattern := Request{
+		URL:             request.URL,
+		URLPattern:      request.URLPattern,
+		URLPath:         request.URLPath,
+		URLPathPattern:  request.URLPathPattern,
+		URLPathTemplate: request.URLPathTemplate,
+		PathParameters:  request.PathParameters,
+	}
+	u, err := url.ParseRequestURI(e.URL)
+	if err != nil {
+		return append(mismatches, Mismatch{Field: "url", Expected: patternJSON(urlPattern), Actual: e.URL})
+	}
+	endpoint := Endpoint{Request: request}
+	hasURL := request.URL != "" || request.URLPattern != "" || request.URLPath != "" ||
+		request.URLPathPattern != "" || request.URLPathTemplate != ""
+	if isMatchPath, _ := pathMatcher(endpoint, u.RawPath, u.Path); hasURL && !isMatchPath {
+		mismatches = append(mismatches, Mismatch{Field: "url", Expected: patternJSON(urlPattern), Actual: e.URL})
+	}
+	if isMatchAuth, _ := authMatcher(endpoint, e.Headers.Get("Authorization")); !isMatchAuth {
+		mismatches = append(mismatches, Mismatch{Field: "auth", Expected: patternJSON(request.Auth), Actual: e.Headers.Get("Authorization")})
+	}
+	if !queryMatcher(endpoint, u.Query()) {
+		mismatches = append(mismatches, Mismatch{Field: "query", Expected: patternJSON(request.QueryParameters), Actual: u.RawQuery})
+	}
+	body := e.Body
+	if e.BodyEncoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return append(mismatches, Mismatch{Field: "body", Expected: patternJSON(request.Body), Actual: e.Body})
+		}
+		body = string(b)
+	}
+	if !bodyMatcher(endpoint, body) {
+		mismatches = append(mismatches, Mismatch{Field: "body", Expected: patternJSON(request.Body), Actual: body})
+	}
+	if !graphqlMatcher(endpoint, u.Query(), body) {
+		mismatches = append(mismatches, Mismatch{Field: "graphql", Expected: patternJSON(request.GraphQL), Actual: body})
+	}
+	if !soapMatcher(endpoint, e.Headers, body) {
+		mismatches = append(mismatches, Mismatch{Field: "soap", Expected: patternJSON(request.SOAP), Actual: body})
+	}
+	if !jsonrpcJournalMatcher(endpoint, body) {
+		mismatches = append(mismatches, Mismatch{Field: "jsonrpc", Expected: patternJSON(request.JSONRPC), Actual: body})
+	}
+	return mismatches
+}
+
+func patternJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// jsonrpcJournalMatcher matches a JSON-RPC pattern against a call, or any call of a batch.
+func jsonrpcJournalMatcher(endpoint Endpoint, body string) bool {
+	if endpoint.Request.JSONRPC == nil {
+		return true
+	}
+	var raws []json.RawMessage
+	trimmed := bytes.TrimSpace([]byte(body))
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return false
+		}
+	} else {
+		raws = []json.RawMessage{trimmed}
+	}
+	for _, raw := range raws {
+		var call jsonrpcCall
+		if err := json.Unmarshal(raw, &call); err != nil || call.Method == nil {
+			continue
+		}
+		params, ok := decodeJSONRPCParams(call.Params)
+		if ok && jsonrpcMatcher(endpoint, *call.Method, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleVerify answers POST /__admin/requests/verify with a Verification body.
+func (j *journal) handleVerify(w http.ResponseWriter, r *http.Request) {
+	var v Verification
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid verification: %s", err), http.StatusBadRequest)
+		return
+	}
+	result, err := j.verify(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid verification: %s", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error(fmt.Sprintf("Failed to write verification: %s", err))
+	}
+}
+
+// VerifyOptions configure how VerifyRequests reaches the admin API.
+type VerifyOptions struct {
+	Token  string       // -admin-token を指定したサーバーに送る Bearer トークン
+	Client *http.Client // 省略時は http.DefaultClient
+}
+
+// VerifyRequests asks the stub server at baseURL for the journaled requests
+// matching v. A count that was not met is reported in the result's Failure,
+// see VerificationResult.Err.
+func VerifyRequests(ctx context.Context, baseURL string, v Verification, opts VerifyOptions) (VerificationResult, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/__admin/requests/verify", bytes.NewReader(b))
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return VerificationResult{}, fmt.Errorf("verification failed with status %s", res.Status)
+	}
+	var result VerificationResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return VerificationResult{}, fmt.Errorf("failed to decode verification: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package stubs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func intPtr(n int) *int { return &n }
+
+func journalOf(t *testing.T, requests ...*http.Request) http.Handler {
+	t.Helper()
+	j := newJournal(100, 1024, nil)
+	handler := j.middleware(http.NotFoundHandler())
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	return muxOf(j.register)
+}
+
+func Test_verifyRequests(t *testing.T) {
+	payment := func(amount string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/payments?currency=JPY", strings.NewReader(`{"amount":`+amount+`}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		return req
+	}
+	rpc := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`[{"jsonrpc":"2.0","method":"eth_blockNumber","id":1},{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc"],"id":2}]`))
+	srv := httptest.NewServer(journalOf(t, payment("100"), payment("250"), httptest.NewRequest(http.MethodGet, "/payments/1", nil), rpc))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		v         Verification
+		wantCount int
+		wantErr   string
+	}{
+		{
+			name: "exactly once with amount 100",
+			v: Verification{
+				Request: Request{Method: "POST", URLPath: "/payments", Body: Matcher{Contains: `"amount":100`}},
+				Exactly: intPtr(1),
+			},
+			wantCount: 1,
+		},
+		{
+			name: "exactly failure",
+			v: Verification{
+				Request: Request{Method: "POST", URLPath: "/payments"},
+				Exactly: intPtr(1),
+			},
+			wantCount: 2,
+			wantErr:   `expected exactly 1 request(s) matching {"urlPath":"/payments","method":"POST"}, received 2`,
+		},
+		{
+			name:      "any method and url",
+			v:         Verification{AtLeast: intPtr(4), AtMost: intPtr(4)},
+			wantCount: 4,
+		},
+		{
+			name: "at least and at most",
+			v: Verification{
+				Request: Request{URLPathTemplate: "/payments/{id}", PathParameters: map[string]Matcher{"id": {Matches: "^[0-9]+$"}}},
+				AtLeast: intPtr(2),
+				AtMost:  intPtr(3),
+			},
+			wantCount: 1,
+			wantErr:   `expected at least 2 and at most 3 request(s) matching {"urlPathTemplate":"/payments/{id}","pathParameters":{"id":{"matches":"^[0-9]+$"}}}, received 1`,
+		},
+		{
+			name: "query and auth",
+			v: Verification{
+				Request: Request{
+					URLPath:         "/payments",
+					QueryParameters: map[string]Matcher{"currency": {EqualTo: "JPY"}},
+					Auth:            &Auth{Bearer: "secret"},
+				},
+				Exactly: intPtr(2),
+			},
+			wantCount: 2,
+		},
+		{
+			name: "json-rpc call in a batch",
+			v: Verification{
+				Request: Request{URLPath: "/rpc", JSONRPC: &JSONRPCRequest{Method: "eth_getBalance"}},
+				Exactly: intPtr(1),
+			},
+			wantCount: 1,
+		},
+		{
+			name: "never",
+			v: Verification{
+				Request: Request{Method: "DELETE"},
+				Exactly: intPtr(0),
+			},
+			wantCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyRequests(context.Background(), srv.URL, tt.v, VerifyOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Count != tt.wantCount || len(got.Requests) != tt.wantCount {
+				t.Errorf("count = %d with %d requests, want %d", got.Count, len(got.Requests), tt.wantCount)
+			}
+			gotErr := ""
+			if err := got.Err(); err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(tt.wantErr, gotErr); diff != "" {
+				t.Errorf("failure mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_verifyRequestsBadPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{name: "invalid json", body: "{", wantBody: "Invalid verification: unexpected EOF\n"},
+		{name: "invalid regexp", body: `{"request":{"body":{"matches":"("}}}`, wantBody: "Invalid verification: request.body.matches: error parsing regexp: missing closing ): `(`\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			journalOf(t, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("{}"))).
+				ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/__admin/requests/verify", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest || rec.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want 400 %q", rec.Code, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_serverVerifyBadPattern(t *testing.T) {
+	server, err := NewServer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("{}")))
+	if _, err := server.Verify(Verification{Request: Request{Body: Matcher{Matches: "("}}}); err == nil {
+		t.Error("Verify() succeeded, want an error for the invalid pattern")
+	}
+}
+
+func Test_verifyNearMisses(t *testing.T) {
+	post := func(path, body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	}
+	srv := httptest.NewServer(journalOf(t,
+		httptest.NewRequest(http.MethodGet, "/payments/1", nil),
+		post("/refunds", `{"amount":300}`),
+		post("/payments", `{"amount":100}`),
+		post("/payments", `{"amount":250}`),
+	))
+	defer srv.Close()
+
+	request := Request{Method: "POST", URLPath: "/payments", Body: Matcher{Contains: `"amount":300`}}
+	tests := []struct {
+		name string
+		v    Verification
+		want []Mismatch // 各ニアミスの最初の不一致
+	}{
+		{
+			name: "too few",
+			v:    Verification{Request: request, Exactly: intPtr(1)},
+			want: []Mismatch{
+				{Field: "url", Expected: `{"urlPath":"/payments"}`, Actual: "/refunds"},
+				{Field: "body", Expected: `{"contains":"\"amount\":300"}`, Actual: `{"amount":100}`},
+				{Field: "body", Expected: `{"contains":"\"amount\":300"}`, Actual: `{"amount":250}`},
+			},
+		},
+		{
+			name: "too many",
+			v:    Verification{Request: Request{Method: "POST"}, AtMost: intPtr(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyRequests(context.Background(), srv.URL, tt.v, VerifyOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Failure == nil {
+				t.Fatal("verification passed, want a failure")
+			}
+			var first []Mismatch
+			for _, miss := range got.Failure.NearMisses {
+				first = append(first, miss.Mismatches[0])
+			}
+			if diff := cmp.Diff(tt.want, first); diff != "" {
+				t.Errorf("near misses mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_verifySharesStubURLMatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+	}{
+		{name: "url", request: Request{Method: "GET", URL: "/files/a%2Fb"}},
+		{name: "url pattern", request: Request{Method: "GET", URLPattern: "^/files/[^/]+%2F"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(Options{Endpoints: []Endpoint{{Request: tt.request, Response: Response{Status: 200}}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/a%2Fb?download=1", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("stub answered %d, want 200", rec.Code)
+			}
+			result, err := server.Verify(Verification{Request: tt.request, Exactly: intPtr(1)})
+			if err == nil {
+				err = result.Err()
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_verifyRequestsToken(t *testing.T) {
+	server, err := NewServer(Options{AdminToken: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	v := Verification{Request: Request{URLPath: "/ping"}, Exactly: intPtr(1)}
+	tests := []struct {
+		name    string
+		opts    VerifyOptions
+		wantErr bool
+	}{
+		{name: "token", opts: VerifyOptions{Token: "s3cret"}},
+		{name: "token with client", opts: VerifyOptions{Token: "s3cret", Client: srv.Client()}},
+		{name: "in-process client", opts: VerifyOptions{Token: "s3cret", Client: &http.Client{Transport: server.Transport()}}},
+		{name: "missing token", opts: VerifyOptions{}, wantErr: true},
+		{name: "wrong token", opts: VerifyOptions{Token: "nope"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyRequests(context.Background(), srv.URL, v, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyRequests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Err() != nil {
+				t.Error(got.Err())
+			}
+		})
+	}
+}
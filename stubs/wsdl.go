@@ -0,0 +1,429 @@
+package stubs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// define the subset of WSDL 1.1 and XML Schema needed to generate stubs
+type wsdlDefinitions struct {
+	TargetNamespace string `xml:"targetNamespace,attr"`
+	Types           struct {
+		Schemas []xsdSchema `xml:"http://www.w3.org/2001/XMLSchema schema"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ types"`
+	Messages  []wsdlMessage  `xml:"http://schemas.xmlsoap.org/wsdl/ message"`
+	PortTypes []wsdlPortType `xml:"http://schemas.xmlsoap.org/wsdl/ portType"`
+	Bindings  []wsdlBinding  `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+	Services  []wsdlService  `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+}
+type wsdlMessage struct {
+	Name  string `xml:"name,attr"`
+	Parts []struct {
+		Name    string `xml:"name,attr"`
+		Element string `xml:"element,attr"`
+		Type    string `xml:"type,attr"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ part"`
+}
+type wsdlPortType struct {
+	Name       string `xml:"name,attr"`
+	Operations []struct {
+		Name  string `xml:"name,attr"`
+		Input struct {
+			Message string `xml:"message,attr"`
+		} `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+		Output struct {
+			Message string `xml:"message,attr"`
+		} `xml:"http://schemas.xmlsoap.org/wsdl/ output"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+type wsdlSOAPBinding struct {
+	Style string `xml:"style,attr"`
+}
+type wsdlSOAPOperation struct {
+	SOAPAction string `xml:"soapAction,attr"`
+	Style      string `xml:"style,attr"`
+}
+type wsdlBinding struct {
+	Name       string           `xml:"name,attr"`
+	Type       string           `xml:"type,attr"`
+	SOAP11     *wsdlSOAPBinding `xml:"http://schemas.xmlsoap.org/wsdl/soap/ binding"`
+	SOAP12     *wsdlSOAPBinding `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ binding"`
+	Operations []struct {
+		Name   string             `xml:"name,attr"`
+		SOAP11 *wsdlSOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+		SOAP12 *wsdlSOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ operation"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+type wsdlAddress struct {
+	Location string `xml:"location,attr"`
+}
+type wsdlService struct {
+	Name  string `xml:"name,attr"`
+	Ports []struct {
+		Name    string       `xml:"name,attr"`
+		Binding string       `xml:"binding,attr"`
+		SOAP11  *wsdlAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap/ address"`
+		SOAP12  *wsdlAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ address"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ port"`
+}
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Elements           []xsdElement     `xml:"http://www.w3.org/2001/XMLSchema element"`
+	ComplexTypes       []xsdComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+	SimpleTypes        []xsdSimpleType  `xml:"http://www.w3.org/2001/XMLSchema simpleType"`
+}
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	ComplexType *xsdComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+	SimpleType  *xsdSimpleType  `xml:"http://www.w3.org/2001/XMLSchema simpleType"`
+}
+type xsdComplexType struct {
+	Name           string    `xml:"name,attr"`
+	Sequence       *xsdGroup `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	All            *xsdGroup `xml:"http://www.w3.org/2001/XMLSchema all"`
+	Choice         *xsdGroup `xml:"http://www.w3.org/2001/XMLSchema choice"`
+	ComplexContent *struct {
+		Extension *struct {
+			Base     string    `xml:"base,attr"`
+			Sequence *xsdGroup `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+		} `xml:"http://www.w3.org/2001/XMLSchema extension"`
+	} `xml:"http://www.w3.org/2001/XMLSchema complexContent"`
+}
+type xsdGroup struct {
+	Elements  []xsdElement `xml:"http://www.w3.org/2001/XMLSchema element"`
+	Sequences []xsdGroup   `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	Choices   []xsdGroup   `xml:"http://www.w3.org/2001/XMLSchema choice"`
+}
+type xsdSimpleType struct {
+	Name        string `xml:"name,attr"`
+	Restriction *struct {
+		Base         string `xml:"base,attr"`
+		Enumerations []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"http://www.w3.org/2001/XMLSchema enumeration"`
+	} `xml:"http://www.w3.org/2001/XMLSchema restriction"`
+}
+
+// WSDLEndpoints generates a starter stub per operation and port of a WSDL
+// document, answering with a sample response envelope.
+func WSDLEndpoints(b []byte) ([]Endpoint, error) {
+	var defs wsdlDefinitions
+	if err := xml.Unmarshal(b, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse WSDL: %w", err)
+	}
+	type port struct {
+		binding, version, path string
+	}
+	var ports []port
+	for _, service := range defs.Services {
+		for _, p := range service.Ports {
+			switch {
+			case p.SOAP12 != nil:
+				ports = append(ports, port{localName(p.Binding), "1.2", locationPath(p.SOAP12.Location)})
+			case p.SOAP11 != nil:
+				ports = append(ports, port{localName(p.Binding), "1.1", locationPath(p.SOAP11.Location)})
+			}
+		}
+	}
+	if len(ports) == 0 {
+		for _, binding := range defs.Bindings {
+			version := "1.1"
+			if binding.SOAP12 != nil {
+				version = "1.2"
+			}
+			ports = append(ports, port{binding.Name, version, "/"})
+		}
+	}
+
+	x := newXSDIndex(defs)
+	var endpoints []Endpoint
+	for _, p := range ports {
+		binding, ok := findByName(defs.Bindings, p.binding, func(b wsdlBinding) string { return b.Name })
+		if !ok {
+			return nil, fmt.Errorf("binding %s not found", p.binding)
+		}
+		portType, ok := findByName(defs.PortTypes, localName(binding.Type), func(pt wsdlPortType) string { return pt.Name })
+		if !ok {
+			return nil, fmt.Errorf("port type %s not found", binding.Type)
+		}
+		bindingStyle := "document"
+		if binding.SOAP11 != nil && binding.SOAP11.Style != "" {
+			bindingStyle = binding.SOAP11.Style
+		} else if binding.SOAP12 != nil && binding.SOAP12.Style != "" {
+			bindingStyle = binding.SOAP12.Style
+		}
+		for _, op := range binding.Operations {
+			soapOp := op.SOAP11
+			if p.version == "1.2" || soapOp == nil {
+				soapOp = op.SOAP12
+			}
+			if soapOp == nil {
+				soapOp = &wsdlSOAPOperation{}
+			}
+			style := bindingStyle
+			if soapOp.Style != "" {
+				style = soapOp.Style
+			}
+			var input, output string
+			for _, o := range portType.Operations {
+				if o.Name == op.Name {
+					input, output = localName(o.Input.Message), localName(o.Output.Message)
+				}
+			}
+
+			request := &SOAPRequest{Action: soapOp.SOAPAction, Operation: op.Name, Version: p.version}
+			var sample string
+			if style == "rpc" {
+				sample = x.rpcSample(op.Name+"Response", defs.TargetNamespace, x.messageParts(output))
+			} else {
+				if el, schema, ok := x.messageElement(input); ok {
+					request.Operation, request.Namespace = el.Name, schema.TargetNamespace
+				}
+				if el, schema, ok := x.messageElement(output); ok {
+					sample = x.elementSample(el, schema)
+				}
+			}
+			body, err := soapResponseBody(p.version, Response{}, "\n"+sample)
+			if err != nil {
+				return nil, err
+			}
+			endpoints = append(endpoints, Endpoint{
+				Request: Request{
+					URLPath: p.path,
+					Method:  "POST",
+					SOAP:    request,
+				},
+				Response: Response{
+					Status: 200,
+					Body:   body,
+				},
+			})
+		}
+	}
+	return endpoints, nil
+}
+
+func localName(qname string) string {
+	return qname[strings.LastIndex(qname, ":")+1:]
+}
+
+func locationPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+func findByName[T any](items []T, name string, nameOf func(T) string) (T, bool) {
+	for _, item := range items {
+		if nameOf(item) == name {
+			return item, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+type xsdIndex struct {
+	defs         wsdlDefinitions
+	elements     map[string]xsdElement
+	complexTypes map[string]xsdComplexType
+	simpleTypes  map[string]xsdSimpleType
+	schemaOf     map[string]*xsdSchema
+}
+
+func newXSDIndex(defs wsdlDefinitions) *xsdIndex {
+	x := &xsdIndex{
+		defs:         defs,
+		elements:     make(map[string]xsdElement),
+		complexTypes: make(map[string]xsdComplexType),
+		simpleTypes:  make(map[string]xsdSimpleType),
+		schemaOf:     make(map[string]*xsdSchema),
+	}
+	for i := range defs.Types.Schemas {
+		schema := &defs.Types.Schemas[i]
+		for _, el := range schema.Elements {
+			x.elements[el.Name] = el
+			x.schemaOf[el.Name] = schema
+		}
+		for _, ct := range schema.ComplexTypes {
+			x.complexTypes[ct.Name] = ct
+		}
+		for _, st := range schema.SimpleTypes {
+			x.simpleTypes[st.Name] = st
+		}
+	}
+	return x
+}
+
+func (x *xsdIndex) messageParts(message string) []xsdElement {
+	m, ok := findByName(x.defs.Messages, message, func(m wsdlMessage) string { return m.Name })
+	if !ok {
+		return nil
+	}
+	var parts []xsdElement
+	for _, part := range m.Parts {
+		if part.Element != "" {
+			if el, ok := x.elements[localName(part.Element)]; ok {
+				parts = append(parts, el)
+				continue
+			}
+		}
+		parts = append(parts, xsdElement{Name: part.Name, Type: part.Type})
+	}
+	return parts
+}
+
+// messageElement returns the element of a document/literal message's first part.
+func (x *xsdIndex) messageElement(message string) (xsdElement, *xsdSchema, bool) {
+	m, ok := findByName(x.defs.Messages, message, func(m wsdlMessage) string { return m.Name })
+	if !ok || len(m.Parts) == 0 || m.Parts[0].Element == "" {
+		return xsdElement{}, nil, false
+	}
+	name := localName(m.Parts[0].Element)
+	el, ok := x.elements[name]
+	if !ok {
+		return xsdElement{}, nil, false
+	}
+	return el, x.schemaOf[name], true
+}
+
+func (x *xsdIndex) elementSample(el xsdElement, schema *xsdSchema) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<tns:%s xmlns:tns="%s">`, el.Name, schema.TargetNamespace)
+	qualified := schema.ElementFormDefault == "qualified"
+	x.writeContent(&sb, el, qualified, 1, 0)
+	fmt.Fprintf(&sb, "</tns:%s>\n", el.Name)
+	return sb.String()
+}
+
+func (x *xsdIndex) rpcSample(name, namespace string, parts []xsdElement) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<tns:%s xmlns:tns="%s">`, name, namespace)
+	sb.WriteString("\n")
+	for _, part := range parts {
+		x.writeElement(&sb, part, false, 1, 0)
+	}
+	fmt.Fprintf(&sb, "</tns:%s>\n", name)
+	return sb.String()
+}
+
+const maxSampleDepth = 6
+
+func (x *xsdIndex) writeElement(sb *strings.Builder, el xsdElement, qualified bool, indent, depth int) {
+	if el.Ref != "" {
+		ref, ok := x.elements[localName(el.Ref)]
+		if !ok {
+			return
+		}
+		el = ref
+	}
+	name := el.Name
+	if qualified {
+		name = "tns:" + name
+	}
+	pad := strings.Repeat("  ", indent)
+	sb.WriteString(pad + "<" + name + ">")
+	x.writeContent(sb, el, qualified, indent+1, depth+1)
+	if strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString(pad)
+	}
+	sb.WriteString("</" + name + ">\n")
+}
+
+// writeContent writes sample children of complex elements or a sample value of simple ones.
+func (x *xsdIndex) writeContent(sb *strings.Builder, el xsdElement, qualified bool, indent, depth int) {
+	ct := el.ComplexType
+	if ct == nil {
+		if c, ok := x.complexTypes[localName(el.Type)]; ok && el.Type != "" {
+			ct = &c
+		}
+	}
+	if ct == nil {
+		sb.WriteString(x.sampleValue(el))
+		return
+	}
+	if depth >= maxSampleDepth {
+		return
+	}
+	children := x.complexChildren(*ct, 0)
+	if len(children) == 0 {
+		return
+	}
+	sb.WriteString("\n")
+	for _, child := range children {
+		x.writeElement(sb, child, qualified, indent, depth)
+	}
+}
+
+func (x *xsdIndex) complexChildren(ct xsdComplexType, depth int) []xsdElement {
+	var children []xsdElement
+	if cc := ct.ComplexContent; cc != nil && cc.Extension != nil {
+		if base, ok := x.complexTypes[localName(cc.Extension.Base)]; ok && depth < maxSampleDepth {
+			children = append(children, x.complexChildren(base, depth+1)...)
+		}
+		children = append(children, groupElements(cc.Extension.Sequence, false)...)
+	}
+	children = append(children, groupElements(ct.Sequence, false)...)
+	children = append(children, groupElements(ct.All, false)...)
+	children = append(children, groupElements(ct.Choice, true)...)
+	return children
+}
+
+// groupElements flattens a model group; only the first alternative of a choice is sampled.
+func groupElements(g *xsdGroup, choice bool) []xsdElement {
+	if g == nil {
+		return nil
+	}
+	var elements []xsdElement
+	elements = append(elements, g.Elements...)
+	for i := range g.Sequences {
+		elements = append(elements, groupElements(&g.Sequences[i], false)...)
+	}
+	for i := range g.Choices {
+		elements = append(elements, groupElements(&g.Choices[i], true)...)
+	}
+	if choice && len(elements) > 1 {
+		elements = elements[:1]
+	}
+	return elements
+}
+
+func (x *xsdIndex) sampleValue(el xsdElement) string {
+	st := el.SimpleType
+	if st == nil {
+		if s, ok := x.simpleTypes[localName(el.Type)]; ok && el.Type != "" {
+			st = &s
+		}
+	}
+	typeName := localName(el.Type)
+	if st != nil && st.Restriction != nil {
+		if len(st.Restriction.Enumerations) > 0 {
+			return st.Restriction.Enumerations[0].Value
+		}
+		typeName = localName(st.Restriction.Base)
+	}
+	switch typeName {
+	case "int", "integer", "long", "short", "byte", "nonNegativeInteger", "positiveInteger",
+		"unsignedInt", "unsignedLong", "unsignedShort", "unsignedByte":
+		return "0"
+	case "decimal", "float", "double":
+		return "0.0"
+	case "boolean":
+		return "false"
+	case "date":
+		return "2000-01-01"
+	case "dateTime":
+		return "2000-01-01T00:00:00Z"
+	case "time":
+		return "00:00:00"
+	default:
+		return "?"
+	}
+}
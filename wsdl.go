@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dev-shimada/api-stubs/stubs"
+)
+
+// wsdlCommand implements `api-stubs wsdl`, which writes a starter stub with a
+// sample response envelope for each operation of a WSDL file.
+func wsdlCommand(args []string) error {
+	fs := flag.NewFlagSet("wsdl", flag.ExitOnError)
+	out := fs.String("o", "", "output stub file (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: api-stubs wsdl [-o configs/service.json] service.wsdl")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a single WSDL file is required")
+	}
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	endpoints, err := stubs.WSDLEndpoints(b)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(endpoints); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0o644)
+}